@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/766b/chi-prometheus"
@@ -39,6 +40,13 @@ var (
 	apiVersion         *string
 	externalUrl        *string
 	maxResults         *int
+	maxBatch           *int
+	idempotencyTTL     *int
+	purgeRetention     *int
+	purgeInterval      *int
+	deletedIds         *string
+	idVersion          *string
+	requireIfMatch     *bool
 )
 
 func init() {
@@ -48,15 +56,22 @@ func init() {
 	metrics = flag.Bool("metrics", false, "expose prometheus metrics")
 	enableCors = flag.Bool("cors", false, "enable cors")
 	timeout = flag.Int("timeout", 60, "request timeout")
-	repoDriver = flag.String("repo", "sqlite3", "type of persistence repository to use, eg. sqlite3, postgres")
+	repoDriver = flag.String("repo", "sqlite3", "type of persistence repository to use, eg. sqlite3, postgres, mysql, bolt, memory")
 	repoUri = flag.String("repo-uri", "", "repo specific connection string")
-	repoMigrations = flag.String("repo-migrations", "./schema", "path to database migrations")
+	repoMigrations = flag.String("repo-migrations", "./schema", "path to database migrations, with a directory per repo, eg. sqlite3")
 	repoSchemaPayments = flag.String("repo-schema-payments", "payments", "the table or schema where we store payments")
 	adminRoutes = flag.Bool("admin", false, "enable admin endpoints")
 	profiling = flag.Bool("profiling", false, "enable profiling")
 	apiVersion = flag.String("api-version", "v1", "api version to expose our services at")
 	externalUrl = flag.String("external-url", "http://localhost:8080", "url to access our microservice from the outside")
 	maxResults = flag.Int("max-results", 20, "Maximum number of results when listing items (eg. payments)")
+	maxBatch = flag.Int("max-batch", 100, "Maximum number of payments created by a single batch request")
+	requireIfMatch = flag.Bool("require-if-match", false, "reject payment updates and deletes without an If-Match header")
+	idVersion = flag.String("id-version", "v4", "uuid version of server generated payment ids, eg. v4 (random), v7 (time-ordered)")
+	idempotencyTTL = flag.Int("idempotency-ttl", 24, "hours during which responses to requests with an Idempotency-Key are replayed")
+	purgeRetention = flag.Int("purge-retention", 0, "hours after which deleted payments can be purged, 0 to keep them forever")
+	deletedIds = flag.String("deleted-ids", "forbid", "what to do with the ids of deleted payments until purged: forbid (410 Gone) or reuse")
+	purgeInterval = flag.Int("purge-interval", 60, "minutes between background purges of expired idempotency records and deleted payments, 0 to only purge on demand")
 }
 
 func main() {
@@ -64,11 +79,17 @@ func main() {
 
 	baseUrl := fmt.Sprintf("%s/%s", *externalUrl, *apiVersion)
 
+	newId, err := util.NewIdGenerator(*idVersion)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Could not create id generator"))
+	}
+
 	paymentsRepo, err := util.NewRepo(util.RepoConfig{
 		Driver:     *repoDriver,
 		Uri:        *repoUri,
 		Migrations: *repoMigrations,
 		Schema:     *repoSchemaPayments,
+		DeletedIds: util.DeletedIds(*deletedIds),
 	})
 
 	if err != nil {
@@ -81,10 +102,17 @@ func main() {
 	}
 
 	defer paymentsRepo.Close()
-	if err := paymentsRepo.Check(); err != nil {
+	if err := paymentsRepo.Check(context.Background()); err != nil {
 		log.Fatal(errors.Wrap(err, "Could connect to the repo"))
 	}
 
+	if *purgeInterval > 0 {
+		stopPurge := make(chan struct{})
+		defer close(stopPurge)
+		go admin.PurgeEvery(paymentsRepo, time.Duration(*purgeRetention)*time.Hour,
+			time.Duration(*purgeInterval)*time.Minute, stopPurge)
+	}
+
 	router := chi.NewRouter()
 
 	router.Use(
@@ -92,10 +120,11 @@ func main() {
 		middleware.Timeout(time.Duration(*timeout)*time.Second),
 		middleware.RedirectSlashes,
 		middleware.Recoverer,
+		util.DropRequestIds,
 		middleware.RequestID,
 		middleware.RealIP,
-		middleware.AllowContentType("application/json", "text/plain"),
-		middleware.NoCache,
+		middleware.AllowContentType("application/json", "text/plain", util.MergePatchContentType, util.JSONPatchContentType),
+		util.NoCache,
 	)
 
 	if *metrics {
@@ -118,9 +147,9 @@ func main() {
 	if *enableCors {
 		cors := cors.New(cors.Options{
 			AllowedOrigins:   []string{"*"},
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-			ExposedHeaders:   []string{"Link"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key", "If-Match", "If-None-Match"},
+			ExposedHeaders:   []string{"Link", "Location", "Idempotent-Replayed", "ETag"},
 			AllowCredentials: true,
 			MaxAge:           300,
 		})
@@ -139,12 +168,23 @@ func main() {
 
 	if *adminRoutes {
 		router.Route("/admin", func(adminRouter chi.Router) {
-			adminRouter.Mount("/", admin.New(paymentsRepo).Routes())
+			adminRouter.Mount("/", admin.New(paymentsRepo, admin.Config{
+				BaseUrl:    fmt.Sprintf("%s/admin", *externalUrl),
+				MaxResults: *maxResults,
+				Retention:  time.Duration(*purgeRetention) * time.Hour,
+			}).Routes())
 		})
 	}
 
 	router.Route("/v1", func(v1Router chi.Router) {
-		v1Router.Mount("/", payments.New(paymentsRepo, baseUrl, *maxResults).Routes())
+		v1Router.Mount("/", payments.New(paymentsRepo, payments.Config{
+			BaseUrl:        baseUrl,
+			MaxResults:     *maxResults,
+			IdempotencyTTL: time.Duration(*idempotencyTTL) * time.Hour,
+			NewId:          newId,
+			RequireIfMatch: *requireIfMatch,
+			MaxBatch:       *maxBatch,
+		}).Routes())
 	})
 
 	if err := chi.Walk(router, func(method string,
@@ -14,6 +14,7 @@ require (
 	github.com/go-chi/chi v4.0.2+incompatible
 	github.com/go-chi/cors v1.0.0
 	github.com/go-chi/render v1.0.1
+	github.com/go-sql-driver/mysql v1.4.1
 	github.com/golang-migrate/migrate v3.5.4+incompatible
 	github.com/lib/pq v1.1.1
 	github.com/mattn/go-sqlite3 v1.10.0
@@ -24,5 +25,6 @@ require (
 	github.com/sirupsen/logrus v1.4.1
 	github.com/smartystreets/assertions v0.0.0-20190401211740-f487f9de1cd3
 	github.com/ulule/limiter v2.2.2+incompatible
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/text v0.3.2 // indirect
 )
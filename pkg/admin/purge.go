@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"context"
+	. "github.com/mfamador/go-payments-api/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+func purge(ctx context.Context, repo Repo, before time.Time) (int, error) {
+	return repo.Purge(ctx, Millis(before))
+}
+
+// PurgeEvery purges, every interval, the expired idempotency records and,
+// when a retention period is set, the payments deleted longer ago than it,
+// until stop is closed.
+func PurgeEvery(repo Repo, retention time.Duration, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			expired, err := repo.PurgeIdempotencyRecords(context.Background(), Millis(now))
+			if err != nil {
+				log.Error("Could not purge expired idempotency records: ", err)
+			} else if expired > 0 {
+				log.Infof("Purged %d expired idempotency records", expired)
+			}
+			if retention == 0 {
+				continue
+			}
+			purged, err := purge(context.Background(), repo, now.Add(-retention))
+			if err != nil {
+				log.Error("Could not purge deleted payments: ", err)
+				continue
+			}
+			if purged > 0 {
+				log.Infof("Purged %d deleted payments", purged)
+			}
+		}
+	}
+}
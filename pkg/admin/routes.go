@@ -2,16 +2,34 @@ package admin
 
 import (
 	"github.com/go-chi/chi"
+	"github.com/mfamador/go-payments-api/pkg/payments"
 	. "github.com/mfamador/go-payments-api/pkg/util"
 	"net/http"
+	"time"
 )
 
+type Config struct {
+	BaseUrl    string
+	MaxResults int
+	Retention  time.Duration
+}
+
 type AdminService struct {
-	repo Repo
+	HttpService
+	repo       Repo
+	maxResults int
+	retention  time.Duration
 }
 
-func New(repo Repo) *AdminService {
-	return &AdminService{repo: repo}
+func New(repo Repo, config Config) *AdminService {
+	return &AdminService{
+		HttpService: HttpService{
+			BaseUrl: config.BaseUrl,
+		},
+		repo:       repo,
+		maxResults: config.MaxResults,
+		retention:  config.Retention,
+	}
 }
 
 func (s *AdminService) Routes() *chi.Mux {
@@ -20,11 +38,16 @@ func (s *AdminService) Routes() *chi.Mux {
 		r.Delete("/", s.DeleteRepo)
 		r.Get("/", s.GetRepo)
 	})
+	router.Route("/payments", func(r chi.Router) {
+		r.Get("/deleted", s.ListDeleted)
+		r.Post("/purge", s.Purge)
+		r.Post("/{id}/undelete", s.Undelete)
+	})
 	return router
 }
 
 func (s *AdminService) DeleteRepo(w http.ResponseWriter, r *http.Request) {
-	err := s.repo.DeleteAll()
+	err := s.repo.DeleteAll(r.Context())
 	if err != nil {
 		HandleHttpError(w, r, http.StatusInternalServerError, err)
 		return
@@ -33,10 +56,71 @@ func (s *AdminService) DeleteRepo(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *AdminService) GetRepo(w http.ResponseWriter, r *http.Request) {
-	info, err := s.repo.Info()
+	info, err := s.repo.Info(r.Context())
 	if err != nil {
 		HandleHttpError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	RenderJSON(w, r, http.StatusOK, info)
 }
+
+// ListDeleted lists soft-deleted payments, paginated, filtered and sorted
+// like payment listings.
+func (s *AdminService) ListDeleted(w http.ResponseWriter, r *http.Request) {
+	payments.ListPayments(w, r, s.repo, s.maxResults, s.UrlFor("/payments/deleted"), true)
+}
+
+// Undelete restores a soft-deleted payment, bumping its version.
+func (s *AdminService) Undelete(w http.ResponseWriter, r *http.Request) {
+	item, err := s.repo.Undelete(r.Context(), &RepoItem{Id: chi.URLParam(r, "id"), Audit: payments.AuditOf(r)})
+	if err != nil {
+		HandleRepoError(w, r, err)
+		return
+	}
+
+	p, err := payments.NewPaymentFromRepoItem(item)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	SetETag(w, p.Version)
+	RenderJSON(w, r, http.StatusOK, &payments.PaymentResponse{
+		Data:  p,
+		Links: payments.Links{},
+	})
+}
+
+type PurgeResponse struct {
+	Purged        int       `json:"purged"`
+	DeletedBefore time.Time `json:"deleted_before"`
+}
+
+// Purge removes for good the payments deleted longer ago than older_than
+// (eg. 720h), or the configured retention period.
+func (s *AdminService) Purge(w http.ResponseWriter, r *http.Request) {
+	retention := s.retention
+	if olderThan := r.URL.Query().Get("older_than"); olderThan != "" {
+		d, err := time.ParseDuration(olderThan)
+		if err != nil || d < 0 {
+			HandleHttpError(w, r, http.StatusBadRequest, ValidationErrors{
+				{Parameter: "older_than", Code: payments.CodeInvalid, Detail: "older_than must be a duration, eg. 720h"},
+			})
+			return
+		}
+		retention = d
+	} else if retention == 0 {
+		HandleHttpError(w, r, http.StatusBadRequest, ValidationErrors{
+			{Parameter: "older_than", Code: payments.CodeRequired, Detail: "older_than is required, as no retention period is configured"},
+		})
+		return
+	}
+
+	before := time.Now().Add(-retention)
+	purged, err := purge(r.Context(), s.repo, before)
+	if err != nil {
+		HandleRepoError(w, r, err)
+		return
+	}
+	RenderJSON(w, r, http.StatusOK, &PurgeResponse{Purged: purged, DeletedBefore: before.UTC()})
+}
@@ -26,7 +26,7 @@ func (s *HealthService) Get(w http.ResponseWriter, r *http.Request) {
 
 	statusCode := http.StatusOK
 	statusMsg := "up"
-	if s.repo.Check() != nil {
+	if s.repo.Check(r.Context()) != nil {
 		statusCode = http.StatusServiceUnavailable
 		statusMsg = "down"
 	}
@@ -0,0 +1,216 @@
+package payments
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const processingDateLayout = "2006-01-02"
+
+var (
+	bankIdCodePattern       = regexp.MustCompile(`^[A-Z0-9]{2,8}$`)
+	numericReferencePattern = regexp.MustCompile(`^[0-9]{1,18}$`)
+)
+
+type PaymentAttributes struct {
+	Amount               string              `json:"amount"`
+	Currency             string              `json:"currency"`
+	BeneficiaryParty     *Party              `json:"beneficiary_party,omitempty"`
+	DebtorParty          *Party              `json:"debtor_party,omitempty"`
+	SponsorParty         *Party              `json:"sponsor_party,omitempty"`
+	ChargesInformation   *ChargesInformation `json:"charges_information,omitempty"`
+	FX                   *FX                 `json:"fx,omitempty"`
+	EndToEndReference    string              `json:"end_to_end_reference,omitempty"`
+	NumericReference     string              `json:"numeric_reference,omitempty"`
+	PaymentId            string              `json:"payment_id,omitempty"`
+	PaymentPurpose       string              `json:"payment_purpose,omitempty"`
+	PaymentScheme        string              `json:"payment_scheme,omitempty"`
+	PaymentType          string              `json:"payment_type,omitempty"`
+	ProcessingDate       string              `json:"processing_date,omitempty"`
+	Reference            string              `json:"reference,omitempty"`
+	SchemePaymentType    string              `json:"scheme_payment_type,omitempty"`
+	SchemePaymentSubType string              `json:"scheme_payment_sub_type,omitempty"`
+}
+
+// Party is a beneficiary, debtor or sponsor of a payment.
+type Party struct {
+	AccountName       string `json:"account_name,omitempty"`
+	AccountNumber     string `json:"account_number"`
+	AccountNumberCode string `json:"account_number_code,omitempty"`
+	AccountType       *int   `json:"account_type,omitempty"`
+	Address           string `json:"address,omitempty"`
+	BankId            string `json:"bank_id"`
+	BankIdCode        string `json:"bank_id_code"`
+	Name              string `json:"name,omitempty"`
+}
+
+type ChargesInformation struct {
+	BearerCode              string   `json:"bearer_code"`
+	SenderCharges           []Charge `json:"sender_charges,omitempty"`
+	ReceiverChargesAmount   string   `json:"receiver_charges_amount,omitempty"`
+	ReceiverChargesCurrency string   `json:"receiver_charges_currency,omitempty"`
+}
+
+type Charge struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type FX struct {
+	ContractReference string `json:"contract_reference,omitempty"`
+	ExchangeRate      string `json:"exchange_rate"`
+	OriginalAmount    string `json:"original_amount"`
+	OriginalCurrency  string `json:"original_currency"`
+}
+
+func (pa *PaymentAttributes) Validate() error {
+	v := NewValidator("/data/attributes")
+	pa.ValidateWith(v)
+	return v.Err()
+}
+
+func (pa *PaymentAttributes) ValidateWith(v *Validator) {
+	validateMoney(v, "amount", pa.Amount, "currency", pa.Currency)
+
+	if pa.BeneficiaryParty != nil {
+		pa.BeneficiaryParty.ValidateWith(v.At("beneficiary_party"))
+	}
+	if pa.DebtorParty != nil {
+		pa.DebtorParty.ValidateWith(v.At("debtor_party"))
+	}
+	if pa.SponsorParty != nil {
+		pa.SponsorParty.ValidateWith(v.At("sponsor_party"))
+	}
+	if pa.ChargesInformation != nil {
+		pa.ChargesInformation.ValidateWith(v.At("charges_information"))
+	}
+	if pa.FX != nil {
+		pa.FX.ValidateWith(v.At("fx"))
+	}
+
+	if pa.NumericReference != "" {
+		v.Check(numericReferencePattern.MatchString(pa.NumericReference), "numeric_reference", CodeInvalid,
+			"Numeric reference must have between 1 and 18 digits")
+	}
+
+	if pa.ProcessingDate != "" {
+		_, err := time.Parse(processingDateLayout, pa.ProcessingDate)
+		v.Check(err == nil, "processing_date", CodeInvalid, "Processing date must be formatted as YYYY-MM-DD")
+	}
+
+	v.OneOf("payment_scheme", pa.PaymentScheme, "FPS", "BACS", "CHAPS", "SEPA", "SWIFT")
+	v.OneOf("payment_type", pa.PaymentType, "Credit", "Debit")
+	v.OneOf("scheme_payment_type", pa.SchemePaymentType, "ImmediatePayment", "ForwardDatedPayment", "StandingOrder")
+	v.OneOf("scheme_payment_sub_type", pa.SchemePaymentSubType,
+		"InternetBanking", "TelephoneBanking", "BranchInstruction", "Letter", "Email", "MobilePaymentsService")
+}
+
+func (p *Party) ValidateWith(v *Validator) {
+	v.Required("account_number", p.AccountNumber)
+	v.OneOf("account_number_code", p.AccountNumberCode, "BBAN", "IBAN")
+	if p.AccountType != nil {
+		v.Check(*p.AccountType == 0 || *p.AccountType == 1, "account_type", CodeInvalid, "Account type must be 0 or 1")
+	}
+	v.Required("bank_id", p.BankId)
+	if v.Required("bank_id_code", p.BankIdCode) {
+		v.Check(bankIdCodePattern.MatchString(p.BankIdCode), "bank_id_code", CodeInvalid,
+			"Bank id code must have between 2 and 8 uppercase letters or digits")
+	}
+}
+
+func (ci *ChargesInformation) ValidateWith(v *Validator) {
+	if v.Required("bearer_code", ci.BearerCode) {
+		v.OneOf("bearer_code", ci.BearerCode, "SHAR", "BEAR", "CRED", "DEBT")
+	}
+
+	charges := v.At("sender_charges")
+	for i, c := range ci.SenderCharges {
+		validateMoney(charges.Index(i), "amount", c.Amount, "currency", c.Currency)
+	}
+
+	if ci.ReceiverChargesAmount != "" || ci.ReceiverChargesCurrency != "" {
+		validateMoney(v, "receiver_charges_amount", ci.ReceiverChargesAmount,
+			"receiver_charges_currency", ci.ReceiverChargesCurrency)
+	}
+}
+
+func (fx *FX) ValidateWith(v *Validator) {
+	if v.Required("exchange_rate", fx.ExchangeRate) {
+		rate, err := ParseDecimal(fx.ExchangeRate)
+		if v.Check(err == nil, "exchange_rate", CodeInvalid, "Invalid exchange rate") {
+			v.Check(rate.Sign() > 0, "exchange_rate", CodeNotPositive, "Exchange rate must be positive")
+		}
+	}
+	validateMoney(v, "original_amount", fx.OriginalAmount, "original_currency", fx.OriginalCurrency)
+}
+
+// Money returns the payment amount in its currency.
+func (pa *PaymentAttributes) Money() (Money, error) {
+	return ParseMoney(pa.Amount, pa.Currency)
+}
+
+// canonical returns a copy of the attributes with every amount in its
+// canonical form, leaving invalid amounts untouched.
+func (pa PaymentAttributes) canonical() PaymentAttributes {
+	pa.Amount = canonicalAmount(pa.Amount, pa.Currency)
+
+	if pa.ChargesInformation != nil {
+		ci := *pa.ChargesInformation
+		ci.SenderCharges = make([]Charge, len(pa.ChargesInformation.SenderCharges))
+		for i, c := range pa.ChargesInformation.SenderCharges {
+			ci.SenderCharges[i] = Charge{Amount: canonicalAmount(c.Amount, c.Currency), Currency: c.Currency}
+		}
+		if len(ci.SenderCharges) == 0 {
+			ci.SenderCharges = nil
+		}
+		ci.ReceiverChargesAmount = canonicalAmount(ci.ReceiverChargesAmount, ci.ReceiverChargesCurrency)
+		pa.ChargesInformation = &ci
+	}
+
+	if pa.FX != nil {
+		fx := *pa.FX
+		fx.OriginalAmount = canonicalAmount(fx.OriginalAmount, fx.OriginalCurrency)
+		pa.FX = &fx
+	}
+
+	return pa
+}
+
+func canonicalAmount(amount string, currency string) string {
+	money, err := ParseMoney(amount, currency)
+	if err != nil {
+		return amount
+	}
+	return money.String()
+}
+
+// validateMoney checks an amount and the currency it is expressed in,
+// both held in sibling fields.
+func validateMoney(v *Validator, amountField string, amount string, currencyField string, currency string) {
+	validAmount := v.Required(amountField, amount)
+	validCurrency := v.Required(currencyField, currency)
+
+	d, err := ParseDecimal(amount)
+	if validAmount {
+		validAmount = v.Check(err == nil, amountField, CodeInvalid, "Invalid amount")
+	}
+
+	if validAmount {
+		validAmount = v.Check(d.Sign() > 0, amountField, CodeNotPositive, "Amount must be positive")
+	}
+
+	if !validCurrency {
+		return
+	}
+
+	c, ok := CurrencyFor(currency)
+	if !v.Check(ok, currencyField, CodeUnknownCurrency, fmt.Sprintf("Unknown ISO 4217 currency: %s", currency)) {
+		return
+	}
+
+	if validAmount {
+		v.Check(d.SignificantScale() <= c.MinorUnits, amountField, CodeTooPrecise,
+			fmt.Sprintf("%s amounts can have at most %v decimal digits", c.Code, c.MinorUnits))
+	}
+}
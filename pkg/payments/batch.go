@@ -0,0 +1,179 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/mfamador/go-payments-api/pkg/util"
+	"net/http"
+)
+
+// Batch modes: atomic batches create every payment or none, partial ones
+// create each valid payment independently.
+const (
+	BatchAtomic  = "atomic"
+	BatchPartial = "partial"
+)
+
+const CodeTooMany = "too_many"
+
+type BatchRequest struct {
+	Payments []*Payment `json:"data"`
+}
+
+// BatchResult tells what happened to a single payment of a batch, with
+// the status it would have had if created on its own.
+type BatchResult struct {
+	Status int      `json:"status"`
+	Id     string   `json:"id,omitempty"`
+	Data   *Payment `json:"data,omitempty"`
+	Links  Links    `json:"links,omitempty"`
+	Error  *Problem `json:"error,omitempty"`
+}
+
+type BatchMeta struct {
+	Mode    string `json:"mode"`
+	Created int    `json:"created"`
+	Failed  int    `json:"failed"`
+}
+
+type BatchResponse struct {
+	Data []*BatchResult `json:"data"`
+	Meta BatchMeta      `json:"meta"`
+}
+
+// CreateBatch creates several payments at once. Atomic batches are
+// rejected as a whole, with a single problem, when any payment is invalid.
+func (s *PaymentsService) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = BatchAtomic
+	}
+	if mode != BatchAtomic && mode != BatchPartial {
+		HandleHttpError(w, r, http.StatusBadRequest, ValidationErrors{{Parameter: "mode", Code: CodeInvalid, Detail: fmt.Sprintf("mode must be one of %s, %s", BatchAtomic, BatchPartial)}})
+		return
+	}
+
+	var br BatchRequest
+	err := json.NewDecoder(r.Body).Decode(&br)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if len(br.Payments) == 0 {
+		HandleHttpError(w, r, http.StatusBadRequest, ValidationErrors{{Pointer: "/data", Code: CodeRequired, Detail: "Payments data is missing"}})
+		return
+	}
+	if s.maxBatch > 0 && len(br.Payments) > s.maxBatch {
+		HandleHttpError(w, r, http.StatusBadRequest, ValidationErrors{{Pointer: "/data", Code: CodeTooMany, Detail: fmt.Sprintf("A batch can have up to %d payments", s.maxBatch)}})
+		return
+	}
+
+	results := make([]*BatchResult, len(br.Payments))
+	all := NewValidator("/data")
+	for i, p := range br.Payments {
+		v := all.Index(i)
+		before := len(*v.errors)
+		if p == nil {
+			v.Add("", CodeRequired, "Payment data is missing")
+		} else {
+			p.ValidateWith(v)
+		}
+		if len(*v.errors) > before {
+			errs := ValidationErrors((*v.errors)[before:])
+			results[i] = &BatchResult{Status: http.StatusBadRequest, Error: NewProblem(r, http.StatusBadRequest, errs)}
+		}
+	}
+
+	if mode == BatchAtomic && !all.Valid() {
+		HandleHttpError(w, r, http.StatusBadRequest, all.Err())
+		return
+	}
+
+	var items []*RepoItem
+	var indexes []int
+	for i, p := range br.Payments {
+		if results[i] != nil {
+			continue
+		}
+		if p.Id == "" {
+			p.Id, err = s.newId()
+			if err != nil {
+				HandleHttpError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		p.Status = StatusCreated
+
+		repoItem, err := p.ToRepoItem()
+		if err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		repoItem.Audit = AuditOf(r)
+		items = append(items, repoItem)
+		indexes = append(indexes, i)
+	}
+
+	errs, err := s.repo.CreateMany(r.Context(), items, mode == BatchAtomic)
+	if err != nil {
+		HandleRepoError(w, r, err)
+		return
+	}
+
+	failed := false
+	for _, err := range errs {
+		failed = failed || err != nil
+	}
+
+	for j, item := range items {
+		i := indexes[j]
+		switch {
+		case errs[j] != nil:
+			status := RepoErrorStatus(errs[j])
+			results[i] = &BatchResult{Status: status, Id: item.Id, Error: NewProblem(r, status, errs[j])}
+		case failed && mode == BatchAtomic:
+			status := http.StatusFailedDependency
+			results[i] = &BatchResult{Status: status, Id: item.Id, Error: NewProblem(r, status, fmt.Errorf("Another payment of the batch failed"))}
+		default:
+			p, err := NewPaymentFromRepoItem(item)
+			if err != nil {
+				HandleHttpError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+			links := make(Links)
+			links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, p.Id))
+			results[i] = &BatchResult{Status: http.StatusCreated, Id: p.Id, Data: p, Links: links}
+		}
+	}
+
+	response := &BatchResponse{Data: results, Meta: BatchMeta{Mode: mode}}
+	status := http.StatusCreated
+	for _, result := range results {
+		if result.Status == http.StatusCreated {
+			response.Meta.Created++
+			continue
+		}
+		response.Meta.Failed++
+		if mode == BatchPartial {
+			status = http.StatusMultiStatus
+		} else if status == http.StatusCreated && result.Status != http.StatusFailedDependency {
+			status = result.Status
+		}
+	}
+
+	RenderJSON(w, r, status, response)
+}
+
+// organisationFromBatch scopes idempotency keys of a batch to the
+// organisation of its first payment.
+func organisationFromBatch(r *http.Request, body []byte) (string, error) {
+	var br BatchRequest
+	err := json.Unmarshal(body, &br)
+	if err != nil {
+		return "", err
+	}
+	if len(br.Payments) == 0 || br.Payments[0] == nil {
+		return "", fmt.Errorf("Payments data is missing")
+	}
+	return br.Payments[0].Organisation, nil
+}
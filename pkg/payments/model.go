@@ -5,51 +5,37 @@ import (
 	"fmt"
 	. "github.com/mfamador/go-payments-api/pkg/util"
 	"github.com/pkg/errors"
-	"strconv"
 	"strings"
+	"time"
 )
 
-type PaymentAttributes struct {
-	Amount string `json:"amount"`
-}
-
-func (pa *PaymentAttributes) Validate() error {
-
-	amount, err := strconv.ParseFloat(pa.Amount, 64)
-	if err != nil {
-		return errors.Wrap(err, "Invalid payment amount")
-	}
-
-	if amount <= 0 {
-		return fmt.Errorf("Payment amount must be positive")
-	}
-
-	return nil
-}
-
 type Payment struct {
 	Id           string            `json:"id"`
 	Type         string            `json:"type"`
 	Version      int               `json:"version"`
 	Organisation string            `json:"organisation_id"`
+	Status       Status            `json:"status"`
 	Attributes   PaymentAttributes `json:"attributes"`
+	CreatedAt    *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time        `json:"updated_at,omitempty"`
+	DeletedAt    *time.Time        `json:"deleted_at,omitempty"`
 }
 
 func (p *Payment) Validate() error {
+	v := NewValidator("/data")
+	p.ValidateWith(v)
+	return v.Err()
+}
 
-	if len(strings.TrimSpace(p.Id)) == 0 {
-		return errors.New("Id is empty")
-	}
-
-	if p.Type != "Payment" {
-		return fmt.Errorf("Invalid type: %s", p.Type)
-	}
-
-	if len(strings.TrimSpace(p.Organisation)) == 0 {
-		return errors.New("Organisation is empty")
+// ValidateWith reports every problem found in the payment to v, allowing
+// callers to validate several payments (eg. in a batch) at once.
+func (p *Payment) ValidateWith(v *Validator) {
+	if p.Id != "" {
+		v.Check(len(strings.TrimSpace(p.Id)) > 0, "id", CodeInvalid, "id must not be blank")
 	}
-
-	return p.Attributes.Validate()
+	v.Check(p.Type == "Payment", "type", CodeInvalid, fmt.Sprintf("Invalid type: %s", p.Type))
+	v.Required("organisation_id", p.Organisation)
+	p.Attributes.ValidateWith(v.At("attributes"))
 }
 
 func (p *Payment) ToRepoItem() (*RepoItem, error) {
@@ -57,8 +43,13 @@ func (p *Payment) ToRepoItem() (*RepoItem, error) {
 		Id:           p.Id,
 		Version:      p.Version,
 		Organisation: p.Organisation,
+		Status:       string(p.Status),
+		CreatedAt:    millisOf(p.CreatedAt),
+		UpdatedAt:    millisOf(p.UpdatedAt),
+		DeletedAt:    millisOf(p.DeletedAt),
 	}
-	bytes, err := json.Marshal(p.Attributes)
+
+	bytes, err := json.Marshal(p.Attributes.canonical())
 	if err != nil {
 		return repoItem, errors.Wrap(err, "Unable to serialize payment attributes")
 	}
@@ -73,6 +64,14 @@ func NewPaymentFromRepoItem(item *RepoItem) (*Payment, error) {
 		Id:           item.Id,
 		Version:      item.Version,
 		Organisation: item.Organisation,
+		Status:       Status(item.Status),
+		CreatedAt:    timeOf(item.CreatedAt),
+		UpdatedAt:    timeOf(item.UpdatedAt),
+		DeletedAt:    timeOf(item.DeletedAt),
+	}
+
+	if p.Status == "" {
+		p.Status = StatusCreated
 	}
 
 	var attrs PaymentAttributes
@@ -82,11 +81,27 @@ func NewPaymentFromRepoItem(item *RepoItem) (*Payment, error) {
 			return p, errors.Wrap(err, "Error parsing repo item attributes")
 		}
 	}
-	p.Attributes = attrs
+	p.Attributes = attrs.canonical()
 
 	return p, nil
 }
 
+// timeOf converts a repo timestamp, nil when unknown.
+func timeOf(millis int64) *time.Time {
+	if millis == 0 {
+		return nil
+	}
+	t := time.Unix(0, millis*int64(time.Millisecond)).UTC()
+	return &t
+}
+
+func millisOf(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.Unix()*1000 + int64(t.Nanosecond())/int64(time.Millisecond)
+}
+
 func NewPaymentsFromRepoItems(items []*RepoItem) ([]*Payment, error) {
 	payments := []*Payment{}
 	for _, i := range items {
@@ -114,4 +129,13 @@ type Links map[string]string
 type PaymentsResponse struct {
 	Data  []*Payment `json:"data"`
 	Links Links      `json:"links"`
+	Meta  *Meta      `json:"meta,omitempty"`
+}
+
+// Meta describes a page of payments. Total is the number of payments
+// matching the filters, missing when the client opted out of counting.
+type Meta struct {
+	Total   *int `json:"total,omitempty"`
+	Limit   int  `json:"limit"`
+	HasMore bool `json:"has_more"`
 }
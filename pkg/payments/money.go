@@ -0,0 +1,202 @@
+package payments
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency, with the number of digits allowed after
+// the decimal separator (eg. 0 for JPY, 2 for GBP, 3 for BHD).
+type Currency struct {
+	Code       string
+	MinorUnits int
+}
+
+var currencies map[string]Currency
+
+func init() {
+	currencies = make(map[string]Currency)
+	for minorUnits, codes := range map[int][]string{
+		0: {
+			"BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG",
+			"RWF", "UGX", "UYI", "VND", "VUV", "XAF", "XOF", "XPF",
+		},
+		2: {
+			"AED", "AFN", "ALL", "AMD", "ANG", "AOA", "ARS", "AUD", "AWG", "AZN",
+			"BAM", "BBD", "BDT", "BGN", "BMD", "BND", "BOB", "BOV", "BRL", "BSD",
+			"BTN", "BWP", "BYN", "BZD", "CAD", "CDF", "CHE", "CHF", "CHW", "CNY",
+			"COP", "COU", "CRC", "CUC", "CUP", "CVE", "CZK", "DKK", "DOP", "DZD",
+			"EGP", "ERN", "ETB", "EUR", "FJD", "FKP", "GBP", "GEL", "GHS", "GIP",
+			"GMD", "GTQ", "GYD", "HKD", "HNL", "HRK", "HTG", "HUF", "IDR", "ILS",
+			"INR", "IRR", "JMD", "KES", "KGS", "KHR", "KPW", "KYD", "KZT", "LAK",
+			"LBP", "LKR", "LRD", "LSL", "MAD", "MDL", "MGA", "MKD", "MMK", "MNT",
+			"MOP", "MRU", "MUR", "MVR", "MWK", "MXN", "MXV", "MYR", "MZN", "NAD",
+			"NGN", "NIO", "NOK", "NPR", "NZD", "PAB", "PEN", "PGK", "PHP", "PKR",
+			"PLN", "QAR", "RON", "RSD", "RUB", "SAR", "SBD", "SCR", "SDG", "SEK",
+			"SGD", "SHP", "SLL", "SOS", "SRD", "SSP", "STN", "SVC", "SYP", "SZL",
+			"THB", "TJS", "TMT", "TOP", "TRY", "TTD", "TWD", "TZS", "UAH", "USD",
+			"USN", "UYU", "UZS", "VES", "WST", "XCD", "YER", "ZAR", "ZMW", "ZWL",
+		},
+		3: {
+			"BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND",
+		},
+		4: {
+			"CLF", "UYW",
+		},
+	} {
+		for _, code := range codes {
+			currencies[code] = Currency{Code: code, MinorUnits: minorUnits}
+		}
+	}
+}
+
+func CurrencyFor(code string) (Currency, bool) {
+	c, ok := currencies[code]
+	return c, ok
+}
+
+var decimalPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+// Decimal is an exact decimal number, represented as an unscaled integer
+// value and the number of digits after the decimal separator.
+type Decimal struct {
+	unscaled *big.Int
+	scale    int
+}
+
+// ParseDecimal only accepts plain decimal notation (eg. "12.30"). Exponents,
+// leading zeros, signs other than "-", and special values are rejected.
+func ParseDecimal(s string) (Decimal, error) {
+	if !decimalPattern.MatchString(s) {
+		return Decimal{}, fmt.Errorf("invalid decimal: %q", s)
+	}
+
+	scale := 0
+	digits := s
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = len(s) - i - 1
+		digits = s[:i] + s[i+1:]
+	}
+
+	unscaled, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal: %q", s)
+	}
+
+	return Decimal{unscaled: unscaled, scale: scale}, nil
+}
+
+func (d Decimal) value() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+func (d Decimal) Sign() int {
+	return d.value().Sign()
+}
+
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// SignificantScale is the number of decimal digits once trailing zeros
+// are dropped (eg. 1 for "1.50").
+func (d Decimal) SignificantScale() int {
+	v := new(big.Int).Set(d.value())
+	scale := d.scale
+	ten := big.NewInt(10)
+	rem := new(big.Int)
+	for scale > 0 {
+		q, r := new(big.Int).QuoRem(v, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		v = q
+		scale--
+	}
+	return scale
+}
+
+// Rescale changes the number of decimal digits, failing rather than
+// rounding when digits would be lost.
+func (d Decimal) Rescale(scale int) (Decimal, error) {
+	if scale >= d.scale {
+		factor := pow10(scale - d.scale)
+		return Decimal{unscaled: new(big.Int).Mul(d.value(), factor), scale: scale}, nil
+	}
+	if d.SignificantScale() > scale {
+		return d, fmt.Errorf("%v has more than %v decimal digits", d, scale)
+	}
+	factor := pow10(d.scale - scale)
+	return Decimal{unscaled: new(big.Int).Quo(d.value(), factor), scale: scale}, nil
+}
+
+func (d Decimal) Cmp(o Decimal) int {
+	a, b := align(d, o)
+	return a.value().Cmp(b.value())
+}
+
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.value()).String()
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= d.scale {
+		digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+	}
+	i := len(digits) - d.scale
+	return sign + digits[:i] + "." + digits[i:]
+}
+
+func align(a Decimal, b Decimal) (Decimal, Decimal) {
+	if a.scale < b.scale {
+		a, _ = a.Rescale(b.scale)
+	} else if b.scale < a.scale {
+		b, _ = b.Rescale(a.scale)
+	}
+	return a, b
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Money is an exact amount in a given currency, never holding more decimal
+// digits than its currency allows.
+type Money struct {
+	Amount   Decimal
+	Currency Currency
+}
+
+func ParseMoney(amount string, currencyCode string) (Money, error) {
+	currency, ok := CurrencyFor(currencyCode)
+	if !ok {
+		return Money{}, fmt.Errorf("unknown currency: %q", currencyCode)
+	}
+
+	d, err := ParseDecimal(amount)
+	if err != nil {
+		return Money{}, err
+	}
+
+	d, err = d.Rescale(currency.MinorUnits)
+	if err != nil {
+		return Money{}, fmt.Errorf("%s amounts can have at most %v decimal digits", currency.Code, currency.MinorUnits)
+	}
+
+	return Money{Amount: d, Currency: currency}, nil
+}
+
+// String returns the canonical representation of the amount, always using
+// the currency minor units (eg. "10.50" for GBP, "1050" for JPY).
+func (m Money) String() string {
+	return m.Amount.String()
+}
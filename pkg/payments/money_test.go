@@ -0,0 +1,137 @@
+package payments
+
+import (
+	"testing"
+)
+
+var parseDecimalTests = []struct {
+	value    string
+	expected string
+	scale    int
+	valid    bool
+}{
+	{"0", "0", 0, true},
+	{"12.30", "12.30", 2, true},
+	{"-5.00", "-5.00", 2, true},
+	{"-0.5", "-0.5", 1, true},
+	{"0.001", "0.001", 3, true},
+	{"123456789012345678901234567890.123456789", "123456789012345678901234567890.123456789", 9, true},
+	{"", "", 0, false},
+	{"+1", "", 0, false},
+	{"01", "", 0, false},
+	{"1.", "", 0, false},
+	{".5", "", 0, false},
+	{"1e3", "", 0, false},
+	{"0x1p3", "", 0, false},
+	{"Inf", "", 0, false},
+	{"NaN", "", 0, false},
+	{"1,00", "", 0, false},
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, test := range parseDecimalTests {
+		d, err := ParseDecimal(test.value)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", test.value, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.value, err)
+			continue
+		}
+		if d.String() != test.expected || d.Scale() != test.scale {
+			t.Errorf("%q: expected %s with scale %d, got %s with scale %d", test.value, test.expected, test.scale, d, d.Scale())
+		}
+	}
+}
+
+var rescaleTests = []struct {
+	value    string
+	scale    int
+	expected string
+}{
+	{"5", 2, "5.00"},
+	{"-5", 2, "-5.00"},
+	{"1.5", 3, "1.500"},
+	{"1.50", 1, "1.5"},
+	{"-1.50", 0, ""},
+	{"100.00", 0, "100"},
+	{"100.5", 0, ""},
+	{"0.001", 2, ""},
+	{"99999999999999999999999999.99", 4, "99999999999999999999999999.9900"},
+}
+
+func TestRescale(t *testing.T) {
+	for _, test := range rescaleTests {
+		d, err := ParseDecimal(test.value)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %v", test.value, err)
+		}
+		rescaled, err := d.Rescale(test.scale)
+		switch {
+		case test.expected == "" && err == nil:
+			t.Errorf("%q to %d digits: expected an error, got %v", test.value, test.scale, rescaled)
+		case test.expected != "" && err != nil:
+			t.Errorf("%q to %d digits: unexpected error %v", test.value, test.scale, err)
+		case test.expected != "" && rescaled.String() != test.expected:
+			t.Errorf("%q to %d digits: expected %s, got %s", test.value, test.scale, test.expected, rescaled)
+		}
+	}
+}
+
+var parseMoneyTests = []struct {
+	amount   string
+	currency string
+	expected string
+}{
+	{"5", "GBP", "5.00"},
+	{"10.5", "EUR", "10.50"},
+	{"-10.5", "USD", "-10.50"},
+	{"1050", "JPY", "1050"},
+	{"1050.00", "JPY", "1050"},
+	{"100.5", "JPY", ""},
+	{"1.5", "BHD", "1.500"},
+	{"1.5001", "BHD", ""},
+	{"0.1234", "CLF", "0.1234"},
+	{"10.001", "GBP", ""},
+	{"10.010", "GBP", "10.01"},
+	{"123456789012345678901234567890", "GBP", "123456789012345678901234567890.00"},
+	{"10.00", "XYZ", ""},
+	{"10.00", "gbp", ""},
+	{"1e3", "GBP", ""},
+}
+
+func TestParseMoney(t *testing.T) {
+	for _, test := range parseMoneyTests {
+		money, err := ParseMoney(test.amount, test.currency)
+		switch {
+		case test.expected == "" && err == nil:
+			t.Errorf("%s %s: expected an error, got %v", test.amount, test.currency, money)
+		case test.expected != "" && err != nil:
+			t.Errorf("%s %s: unexpected error %v", test.amount, test.currency, err)
+		case test.expected != "" && money.String() != test.expected:
+			t.Errorf("%s %s: expected %s, got %s", test.amount, test.currency, test.expected, money)
+		}
+	}
+}
+
+func TestDecimalCmp(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.5", "1.50", 0},
+		{"1.5", "1.49", 1},
+		{"-2", "1.99", -1},
+		{"10", "9.999", 1},
+		{"100000000000000000000.01", "100000000000000000000.1", -1},
+	} {
+		a, _ := ParseDecimal(test.a)
+		b, _ := ParseDecimal(test.b)
+		if c := a.Cmp(b); c != test.expected {
+			t.Errorf("%s <=> %s: expected %d, got %d", test.a, test.b, test.expected, c)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package payments
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	. "github.com/mfamador/go-payments-api/pkg/util"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	offsetLinkPattern string
+	cursorLinkPattern string
+	firstLinkPattern  string
+)
+
+func init() {
+	offsetLinkPattern = "?from=%v&to=%v"
+	cursorLinkPattern = "?cursor=%v&limit=%v"
+	firstLinkPattern = "?limit=%v"
+}
+
+type sortField struct {
+	RepoSort
+	value func(p *Payment) string
+}
+
+// sortFields are the fields payment listings can be sorted by, along with
+// the value of each one in a payment, kept in cursors.
+var sortFields = map[string]sortField{
+	"id":              {RepoSort{Field: "id"}, func(p *Payment) string { return p.Id }},
+	"organisation_id": {RepoSort{Field: "organisation"}, func(p *Payment) string { return p.Organisation }},
+	"status":          {RepoSort{Field: "status"}, func(p *Payment) string { return string(p.Status) }},
+	"amount":          {RepoSort{Field: "amount", Attribute: true, Numeric: true}, func(p *Payment) string { return p.Attributes.Amount }},
+	"currency":        {RepoSort{Field: "currency", Attribute: true}, func(p *Payment) string { return p.Attributes.Currency }},
+	"reference":       {RepoSort{Field: "reference", Attribute: true}, func(p *Payment) string { return p.Attributes.Reference }},
+	"processing_date": {RepoSort{Field: "processing_date", Attribute: true}, func(p *Payment) string { return p.Attributes.ProcessingDate }},
+	"created_at":      {RepoSort{Field: "created_at", Numeric: true}, func(p *Payment) string { return strconv.FormatInt(millisOf(p.CreatedAt), 10) }},
+	"updated_at":      {RepoSort{Field: "updated_at", Numeric: true}, func(p *Payment) string { return strconv.FormatInt(millisOf(p.UpdatedAt), 10) }},
+}
+
+// Page is the part of a payments listing requested by a client: either an
+// offset range (from/to), or up to limit payments next to an opaque cursor
+// (cursor/limit), which stays stable while payments are created or deleted.
+// Sort lists the fields to sort by, descending when prefixed with "-".
+// Count tells whether to count the payments matching the filters.
+type Page struct {
+	From   int
+	Limit  int
+	Sort   []string
+	Cursor *RepoCursor
+	Keyset bool
+	Count  bool
+}
+
+func NewPage(params url.Values, maxResults int) (*Page, error) {
+	var errs ValidationErrors
+	invalid := func(param string, detail string) {
+		errs = append(errs, FieldError{Parameter: param, Code: CodeInvalid, Detail: detail})
+	}
+
+	page := &Page{Limit: maxResults, Count: true}
+
+	if count := params.Get("count"); count != "" {
+		c, err := strconv.ParseBool(count)
+		if err != nil {
+			invalid("count", "count must be true or false")
+		}
+		page.Count = c || err != nil
+	}
+
+	if sort := params.Get("sort"); sort != "" {
+		seen := make(map[string]bool)
+		for _, field := range strings.Split(sort, ",") {
+			name := strings.TrimPrefix(field, "-")
+			if _, ok := sortFields[name]; !ok || seen[name] {
+				invalid("sort", fmt.Sprintf("Invalid sort field: %s", field))
+				continue
+			}
+			seen[name] = true
+			page.Sort = append(page.Sort, field)
+		}
+	}
+
+	if params.Get("cursor") == "" && params.Get("limit") == "" {
+		from := IntFromStringOrDefault(params.Get("from"), 0)
+		to := IntFromStringOrDefault(params.Get("to"), maxResults)
+
+		limit := to - from
+
+		if from < 0 || limit <= 0 {
+			return nil, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to)
+		}
+
+		page.From = from
+		page.Limit = min(limit, maxResults)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		return page, nil
+	}
+
+	for _, param := range []string{"from", "to"} {
+		if params.Get(param) != "" {
+			invalid(param, fmt.Sprintf("%s cannot be combined with cursor or limit", param))
+		}
+	}
+
+	page.Keyset = true
+
+	if l := params.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			invalid("limit", "limit must be a positive integer")
+		} else {
+			page.Limit = min(limit, maxResults)
+		}
+	}
+
+	if c := params.Get("cursor"); c != "" {
+		cursor, err := page.decodeCursor(c)
+		if err != nil {
+			invalid("cursor", "Invalid cursor, or cursor used with another sort order")
+		} else {
+			page.Cursor = cursor
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return page, nil
+}
+
+// Apply restricts query to the page, plus one more item telling whether
+// there are more items to list.
+func (p *Page) Apply(query *RepoQuery) {
+	query.Offset = p.From
+	query.Limit = p.Limit + 1
+	query.Cursor = p.Cursor
+	query.Sort = nil
+	for _, field := range p.Sort {
+		sort := sortFields[strings.TrimPrefix(field, "-")].RepoSort
+		sort.Descending = strings.HasPrefix(field, "-")
+		query.Sort = append(query.Sort, sort)
+	}
+}
+
+func (p *Page) sortParam() string {
+	return strings.Join(p.Sort, ",")
+}
+
+// cursorAt returns a cursor positioned next to a payment.
+func (p *Page) cursorAt(payment *Payment, backward bool) *RepoCursor {
+	c := &RepoCursor{Id: payment.Id, Backward: backward}
+	for _, field := range p.Sort {
+		c.Values = append(c.Values, sortFields[strings.TrimPrefix(field, "-")].value(payment))
+	}
+	return c
+}
+
+// Trim drops the extra item fetched by the query, reporting whether there
+// was one.
+func (p *Page) Trim(items []*RepoItem) ([]*RepoItem, bool) {
+	if len(items) <= p.Limit {
+		return items, false
+	}
+	if p.Cursor != nil && p.Cursor.Backward {
+		return items[len(items)-p.Limit:], true
+	}
+	return items[:p.Limit], true
+}
+
+// Links returns the self, first, last, next and prev links of the page of
+// a listing, found at its url, each one carrying the filters and sort order
+// of the listing. next is missing on the last page, and prev on the first
+// one. With offsets, last needs the total number of payments, when counted.
+func (p *Page) Links(listing string, params url.Values, items []*Payment, more bool, total *int) Links {
+	link := func(query string) string {
+		if len(params) > 0 {
+			query += "&" + params.Encode()
+		}
+		return listing + query
+	}
+
+	links := make(Links)
+
+	if !p.Keyset {
+		links["self"] = link(fmt.Sprintf(offsetLinkPattern, p.From, p.From+p.Limit))
+		links["first"] = link(fmt.Sprintf(offsetLinkPattern, 0, p.Limit))
+		if total != nil {
+			last := max(*total-1, 0) / p.Limit * p.Limit
+			links["last"] = link(fmt.Sprintf(offsetLinkPattern, last, last+p.Limit))
+		}
+		if more {
+			links["next"] = link(fmt.Sprintf(offsetLinkPattern, p.From+p.Limit, p.From+2*p.Limit))
+		}
+		if p.From > 0 {
+			prev := max(p.From-p.Limit, 0)
+			links["prev"] = link(fmt.Sprintf(offsetLinkPattern, prev, prev+p.Limit))
+		}
+		return links
+	}
+
+	if p.Cursor == nil {
+		links["self"] = link(fmt.Sprintf(firstLinkPattern, p.Limit))
+	} else {
+		links["self"] = link(fmt.Sprintf(cursorLinkPattern, p.encodeCursor(p.Cursor), p.Limit))
+	}
+	links["first"] = link(fmt.Sprintf(firstLinkPattern, p.Limit))
+	links["last"] = link(fmt.Sprintf(cursorLinkPattern, p.encodeCursor(&RepoCursor{Backward: true}), p.Limit))
+
+	if len(items) == 0 {
+		return links
+	}
+
+	backward := p.Cursor != nil && p.Cursor.Backward
+	if !backward && more || backward && p.Cursor.Id != "" {
+		next := p.cursorAt(items[len(items)-1], false)
+		links["next"] = link(fmt.Sprintf(cursorLinkPattern, p.encodeCursor(next), p.Limit))
+	}
+	if backward && more || !backward && p.Cursor != nil {
+		prev := p.cursorAt(items[0], true)
+		links["prev"] = link(fmt.Sprintf(cursorLinkPattern, p.encodeCursor(prev), p.Limit))
+	}
+	return links
+}
+
+// Meta returns the metadata of the page, given its links.
+func (p *Page) Meta(links Links, total *int) *Meta {
+	_, more := links["next"]
+	return &Meta{Total: total, Limit: p.Limit, HasMore: more}
+}
+
+// cursorData is encoded into opaque cursors. It keeps the sort order the
+// cursor was created for, as its values are meaningless for another one.
+// The cursor of the last page has no id.
+type cursorData struct {
+	Id       string   `json:"id"`
+	Values   []string `json:"values,omitempty"`
+	Sort     string   `json:"sort,omitempty"`
+	Backward bool     `json:"backward,omitempty"`
+}
+
+func (p *Page) encodeCursor(c *RepoCursor) string {
+	data, _ := json.Marshal(&cursorData{Id: c.Id, Values: c.Values, Sort: p.sortParam(), Backward: c.Backward})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (p *Page) decodeCursor(s string) (*RepoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c cursorData
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	last := c.Id == "" && c.Backward && len(c.Values) == 0
+	if c.Sort != p.sortParam() || !last && (c.Id == "" || len(c.Values) != len(p.Sort)) {
+		return nil, fmt.Errorf("cursor does not match the sort order")
+	}
+	return &RepoCursor{Id: c.Id, Values: c.Values, Backward: c.Backward}, nil
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,118 @@
+package payments
+
+import (
+	"fmt"
+	. "github.com/mfamador/go-payments-api/pkg/util"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// linkParams are the query parameters of List kept in the pagination links:
+// its filters, sort order and count opt-out.
+var linkParams = []string{"organisation_id", "status", "currency", "amount_min", "amount_max", "reference",
+	"created_after", "created_before", "updated_after", "updated_before", "sort", "count"}
+
+// timestampLayouts are the accepted formats of timestamp filters: a date
+// (midnight UTC) or a RFC 3339 time.
+var timestampLayouts = []string{"2006-01-02", time.RFC3339Nano}
+
+// NewRepoQuery translates the filters of a payments listing into a repo
+// query, reporting every invalid parameter at once.
+func NewRepoQuery(params url.Values) (RepoQuery, error) {
+	var errs ValidationErrors
+	invalid := func(param string, code string, detail string) {
+		errs = append(errs, FieldError{Parameter: param, Code: code, Detail: detail})
+	}
+
+	query := RepoQuery{
+		Organisation: strings.TrimSpace(params.Get("organisation_id")),
+		Reference:    strings.TrimSpace(params.Get("reference")),
+	}
+
+	if status := params.Get("status"); status != "" {
+		if Status(status).Valid() {
+			query.Status = status
+		} else {
+			invalid("status", CodeInvalid, fmt.Sprintf("Invalid status: %s", status))
+		}
+	}
+
+	if currency := params.Get("currency"); currency != "" {
+		if _, ok := CurrencyFor(currency); ok {
+			query.Currency = currency
+		} else {
+			invalid("currency", CodeUnknownCurrency, fmt.Sprintf("unknown currency: %q", currency))
+		}
+	}
+
+	var min, max *Decimal
+	for _, param := range []string{"amount_min", "amount_max"} {
+		value := params.Get(param)
+		if value == "" {
+			continue
+		}
+		d, err := ParseDecimal(value)
+		if err != nil {
+			invalid(param, CodeInvalid, err.Error())
+			continue
+		}
+		if param == "amount_min" {
+			query.AmountMin, min = d.String(), &d
+		} else {
+			query.AmountMax, max = d.String(), &d
+		}
+	}
+	if min != nil && max != nil && min.Cmp(*max) > 0 {
+		invalid("amount_max", CodeInvalid, "amount_max must not be lower than amount_min")
+	}
+
+	timestamps := []struct {
+		param string
+		value *int64
+	}{
+		{"created_after", &query.CreatedAfter},
+		{"created_before", &query.CreatedBefore},
+		{"updated_after", &query.UpdatedAfter},
+		{"updated_before", &query.UpdatedBefore},
+	}
+	for _, ts := range timestamps {
+		value := params.Get(ts.param)
+		if value == "" {
+			continue
+		}
+		t, ok := parseTimestamp(value)
+		if !ok {
+			invalid(ts.param, CodeInvalid, fmt.Sprintf("%s must be a date (YYYY-MM-DD) or a RFC 3339 time", ts.param))
+			continue
+		}
+		*ts.value = millisOf(&t)
+	}
+
+	if len(errs) > 0 {
+		return query, errs
+	}
+	return query, nil
+}
+
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// linkParamsOf keeps the link parameters found in params, to carry
+// them over to pagination links.
+func linkParamsOf(params url.Values) url.Values {
+	kept := url.Values{}
+	for _, p := range linkParams {
+		if v := params.Get(p); v != "" {
+			kept.Set(p, v)
+		}
+	}
+	return kept
+}
@@ -1,40 +1,62 @@
 package payments
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/go-chi/chi"
 	. "github.com/mfamador/go-payments-api/pkg/util"
 	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
-	maxResults          int
-	paymentsLinkPattern string
-	paymentLinkPattern  string
+	maxResults         int
+	paymentsLink       string
+	paymentLinkPattern string
 )
 
 func init() {
-	paymentsLinkPattern = "/payments?from=%v&to=%v"
-	paymentLinkPattern = "/payment/%v"
+	paymentsLink = "/payments"
+	paymentLinkPattern = "/payments/%v"
+}
+
+type Config struct {
+	BaseUrl        string
+	MaxResults     int
+	IdempotencyTTL time.Duration
+	NewId          IdGenerator
+	RequireIfMatch bool
+	MaxBatch       int
 }
 
 type PaymentsService struct {
 	HttpService
-	repo       Repo
-	maxResults int
+	repo           Repo
+	maxResults     int
+	idempotency    *Idempotency
+	newId          IdGenerator
+	requireIfMatch bool
+	maxBatch       int
 }
 
-func New(repo Repo, baseUrl string, maxResults int) *PaymentsService {
+func New(repo Repo, config Config) *PaymentsService {
 	return &PaymentsService{
 		HttpService: HttpService{
-			BaseUrl: baseUrl,
+			BaseUrl: config.BaseUrl,
 		},
-		repo:       repo,
-		maxResults: maxResults,
+		repo:           repo,
+		maxResults:     config.MaxResults,
+		idempotency:    NewIdempotency(repo, config.IdempotencyTTL),
+		newId:          config.NewId,
+		requireIfMatch: config.RequireIfMatch,
+		maxBatch:       config.MaxBatch,
 	}
 }
 
@@ -42,63 +64,85 @@ func (s *PaymentsService) Routes() *chi.Mux {
 	router := chi.NewRouter()
 	router.Get("/payments", s.List)
 	router.Get("/payments/{id}", s.Fetch)
-	router.Post("/payments", s.Create)
+	router.Post("/payments", s.idempotency.Handler(organisationFromBody, s.Create))
+	router.Post("/payments/batch", s.idempotency.Handler(organisationFromBatch, s.CreateBatch))
 	router.Put("/payments/{id}", s.Update)
+	router.Patch("/payments/{id}", s.Patch)
 	router.Delete("/payments/{id}", s.Delete)
+	router.Get("/payments/{id}/versions", s.Versions)
+	router.Get("/payments/{id}/versions/{version}", s.Version)
+	router.Get("/payments/{id}/diff", s.Diff)
+	for action, status := range Actions {
+		router.Post(fmt.Sprintf("/payments/{id}/%s", action), s.idempotency.Handler(s.organisationFromRepo, s.Transition(status)))
+	}
 	return router
 }
 
 func (s *PaymentsService) List(w http.ResponseWriter, r *http.Request) {
-	from := IntFromStringOrDefault(r.URL.Query().Get("from"), 0)
-	to := IntFromStringOrDefault(r.URL.Query().Get("to"), s.maxResults)
-
-	limit := to - from
+	ListPayments(w, r, s.repo, s.maxResults, s.UrlFor(paymentsLink), false)
+}
 
-	if limit <= 0 {
-		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Invalid from (%v) or to (%v) query params", from, to))
+// ListPayments renders the page of payments requested, either live or
+// deleted ones, linking to the other pages of the listing found at the
+// given url.
+func ListPayments(w http.ResponseWriter, r *http.Request, repo Repo, maxResults int, listing string, deleted bool) {
+	page, err := NewPage(r.URL.Query(), maxResults)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if limit > s.maxResults {
-		limit = s.maxResults
+	query, err := NewRepoQuery(r.URL.Query())
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
 	}
+	query.Deleted = deleted
+	page.Apply(&query)
 
-	repoItems, err := s.repo.List(from, limit)
+	repoItems, err := repo.List(r.Context(), query)
 	if err != nil {
-		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		HandleRepoError(w, r, err)
 		return
 	}
 
+	repoItems, more := page.Trim(repoItems)
+
 	payments, err := NewPaymentsFromRepoItems(repoItems)
 	if err != nil {
 		HandleHttpError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	links := make(Links)
-	links["self"] = s.UrlFor(fmt.Sprintf(paymentsLinkPattern, from, to))
-	links["next"] = s.UrlFor(fmt.Sprintf(paymentsLinkPattern, to, to+limit))
-
-	if from >= limit {
-		links["prev"] = s.UrlFor(fmt.Sprintf(paymentsLinkPattern, from-limit, from))
+	var total *int
+	if page.Count {
+		count, err := repo.Count(r.Context(), query)
+		if err != nil {
+			HandleRepoError(w, r, err)
+			return
+		}
+		total = &count
 	}
 
+	links := page.Links(listing, linkParamsOf(r.URL.Query()), payments, more, total)
 	RenderJSON(w, r, http.StatusOK, &PaymentsResponse{
 		Data:  payments,
 		Links: links,
+		Meta:  page.Meta(links, total),
 	})
-
 }
 
 func (s *PaymentsService) Fetch(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	found, err := s.repo.Fetch(&RepoItem{Id: id})
+	found, err := s.repo.Fetch(r.Context(), &RepoItem{Id: id})
 	if err != nil {
-		if s.repo.IsNotFound(err) {
-			HandleHttpError(w, r, http.StatusNotFound, err)
-		} else {
-			HandleHttpError(w, r, http.StatusInternalServerError, err)
-		}
+		HandleRepoError(w, r, err)
+		return
+	}
+
+	if IfNoneMatch(r).MatchesWeak(found.Version) {
+		SetETag(w, found.Version)
+		RenderNotModified(w, r)
 		return
 	}
 
@@ -111,6 +155,7 @@ func (s *PaymentsService) Fetch(w http.ResponseWriter, r *http.Request) {
 	links := make(Links)
 	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
 
+	SetETag(w, found.Version)
 	RenderJSON(w, r, http.StatusOK, &PaymentResponse{
 		Data:  p,
 		Links: links,
@@ -120,30 +165,40 @@ func (s *PaymentsService) Fetch(w http.ResponseWriter, r *http.Request) {
 func (s *PaymentsService) Delete(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	versionQP := strings.TrimSpace(r.URL.Query().Get("version"))
-	version, err := strconv.Atoi(versionQP)
-	if err != nil {
-		HandleHttpError(w, r, http.StatusBadRequest, err)
+	ifMatch := IfMatch(r)
+	if !s.checkPreconditionPresent(w, r, ifMatch) {
 		return
 	}
 
-	_, err = s.repo.Fetch(&RepoItem{Id: id})
-	if err != nil {
-		if s.repo.IsNotFound(err) {
-			HandleHttpError(w, r, http.StatusNotFound, err)
-		} else {
-			HandleHttpError(w, r, http.StatusInternalServerError, err)
+	var version int
+	var err error
+	if !ifMatch.Present {
+		versionQP := strings.TrimSpace(r.URL.Query().Get("version"))
+		version, err = strconv.Atoi(versionQP)
+		if err != nil {
+			HandleHttpError(w, r, http.StatusBadRequest, err)
+			return
 		}
-		return
 	}
 
-	err = s.repo.Delete(&RepoItem{Id: id, Version: version})
-	if err != nil {
-		errorCode := http.StatusInternalServerError
-		if s.repo.IsNotFound(err) || s.repo.IsConflict(err) {
-			errorCode = http.StatusConflict
+	err = s.repo.WithTx(r.Context(), func(tx Repo) error {
+		found, err := tx.Fetch(r.Context(), &RepoItem{Id: id})
+		if err != nil {
+			return err
+		}
+
+		err = checkIfMatch(ifMatch, found)
+		if err != nil {
+			return err
 		}
-		HandleHttpError(w, r, errorCode, err)
+		if ifMatch.Present {
+			version = found.Version
+		}
+
+		return writeError(ifMatch, tx.Delete(r.Context(), &RepoItem{Id: id, Version: version, Audit: AuditOf(r)}))
+	})
+	if err != nil {
+		handleError(w, r, err)
 		return
 	}
 
@@ -152,7 +207,7 @@ func (s *PaymentsService) Delete(w http.ResponseWriter, r *http.Request) {
 
 func (s *PaymentsService) Create(w http.ResponseWriter, r *http.Request) {
 
-	p, err := decodePayment(r)
+	p, err := decodePayment(r.Body)
 	if err != nil {
 		HandleHttpError(w, r, http.StatusBadRequest, err)
 		return
@@ -166,20 +221,26 @@ func (s *PaymentsService) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if p.Id == "" {
+		p.Id, err = s.newId()
+		if err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	p.Status = StatusCreated
+
 	repoItem, err := p.ToRepoItem()
 	if err != nil {
 		HandleHttpError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	createdItem, err := s.repo.Create(repoItem)
+	repoItem.Audit = AuditOf(r)
+	createdItem, err := s.repo.Create(r.Context(), repoItem)
 	if err != nil {
-		if s.repo.IsConflict(err) {
-			HandleHttpError(w, r, http.StatusConflict, err)
-		} else {
-			HandleHttpError(w, r, http.StatusInternalServerError, err)
-		}
-
+		HandleRepoError(w, r, err)
 		return
 	}
 
@@ -192,6 +253,8 @@ func (s *PaymentsService) Create(w http.ResponseWriter, r *http.Request) {
 	links := make(Links)
 	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, p.Id))
 
+	w.Header().Set("Location", links["self"])
+	SetETag(w, p.Version)
 	RenderJSON(w, r, http.StatusCreated, &PaymentResponse{
 		Data:  p,
 		Links: links,
@@ -200,7 +263,12 @@ func (s *PaymentsService) Create(w http.ResponseWriter, r *http.Request) {
 
 func (s *PaymentsService) Update(w http.ResponseWriter, r *http.Request) {
 
-	p, err := decodePayment(r)
+	ifMatch := IfMatch(r)
+	if !s.checkPreconditionPresent(w, r, ifMatch) {
+		return
+	}
+
+	p, err := decodePayment(r.Body)
 	if err != nil {
 		HandleHttpError(w, r, http.StatusBadRequest, err)
 		return
@@ -215,54 +283,314 @@ func (s *PaymentsService) Update(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
 	if p.Id != "" && id != p.Id {
-		HandleHttpError(w, r, http.StatusBadRequest, err)
+		HandleHttpError(w, r, http.StatusBadRequest, ValidationErrors{{Pointer: "/data/id", Code: CodeMismatch, Detail: "Id does not match the payment being updated"}})
 		return
 	}
+	p.Id = id
 
-	_, err = s.repo.Fetch(&RepoItem{Id: id})
-	if err != nil {
-		if s.repo.IsNotFound(err) {
-			HandleHttpError(w, r, http.StatusNotFound, err)
-		} else {
-			HandleHttpError(w, r, http.StatusInternalServerError, err)
+	err = s.repo.WithTx(r.Context(), func(tx Repo) error {
+		found, err := tx.Fetch(r.Context(), &RepoItem{Id: id})
+		if err != nil {
+			return err
 		}
+
+		err = checkIfMatch(ifMatch, found)
+		if err != nil {
+			return err
+		}
+
+		p, err = save(tx, r, ifMatch, found, p)
+		return err
+	})
+	if err != nil {
+		handleError(w, r, err)
 		return
 	}
 
-	repoItem, err := p.ToRepoItem()
+	s.renderPayment(w, r, p)
+}
+
+// Patch applies a JSON Merge Patch or a JSON Patch to the payment document,
+// as it would be sent to Update, and saves the result once validated.
+func (s *PaymentsService) Patch(w http.ResponseWriter, r *http.Request) {
+
+	ifMatch := IfMatch(r)
+	if !s.checkPreconditionPresent(w, r, ifMatch) {
+		return
+	}
+
+	patch, err := PatchFor(r.Header.Get("Content-Type"))
 	if err != nil {
-		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		HandleHttpError(w, r, PatchErrorStatus(err), err)
 		return
 	}
 
-	updatedItem, err := s.repo.Update(repoItem)
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		if s.repo.IsConflict(err) {
-			HandleHttpError(w, r, http.StatusConflict, err)
-		} else {
-			HandleHttpError(w, r, http.StatusInternalServerError, err)
+		HandleHttpError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	var p *Payment
+	err = s.repo.WithTx(r.Context(), func(tx Repo) error {
+		found, err := tx.Fetch(r.Context(), &RepoItem{Id: id})
+		if err != nil {
+			return err
+		}
+
+		err = checkIfMatch(ifMatch, found)
+		if err != nil {
+			return err
+		}
+
+		current, err := NewPaymentFromRepoItem(found)
+		if err != nil {
+			return &statusError{http.StatusInternalServerError, err}
+		}
+
+		doc, err := json.Marshal(&PaymentRequest{Payment: current})
+		if err != nil {
+			return &statusError{http.StatusInternalServerError, err}
+		}
+
+		patched, err := patch(doc, body)
+		if err != nil {
+			return &statusError{PatchErrorStatus(err), err}
 		}
+
+		err = checkReadOnly(doc, patched)
+		if err != nil {
+			return &statusError{http.StatusUnprocessableEntity, err}
+		}
+
+		p, err = decodePayment(bytes.NewReader(patched))
+		if err != nil {
+			return &statusError{http.StatusBadRequest, err}
+		}
+
+		err = p.Validate()
+		if err != nil {
+			return &statusError{http.StatusBadRequest, err}
+		}
+
+		if p.Id != id {
+			return &statusError{http.StatusBadRequest, ValidationErrors{{Pointer: "/data/id", Code: CodeMismatch, Detail: "Id does not match the payment being updated"}}}
+		}
+
+		p, err = save(tx, r, ifMatch, found, p)
+		return err
+	})
+	if err != nil {
+		handleError(w, r, err)
 		return
 	}
 
+	s.renderPayment(w, r, p)
+}
+
+// readOnlyFields are the members of a payment document kept by the
+// service: status changes through its transitions, the organisation never
+// does, and the others on every write.
+var readOnlyFields = []string{"organisation_id", "version", "status", "created_at", "updated_at", "deleted_at"}
+
+// checkReadOnly reports the read-only fields a patch changed, rather than
+// silently ignoring those changes. Documents that are not even objects are
+// left for decoding to report.
+func checkReadOnly(doc []byte, patched []byte) error {
+	var before, after struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if json.Unmarshal(doc, &before) != nil || json.Unmarshal(patched, &after) != nil {
+		return nil
+	}
+
+	errs := ValidationErrors{}
+	for _, field := range readOnlyFields {
+		if !reflect.DeepEqual(before.Data[field], after.Data[field]) {
+			errs = append(errs, FieldError{Pointer: "/data/" + field, Code: CodeReadOnly, Detail: "Read-only fields cannot be changed by a patch"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// save stores p as the new version of the found payment, keeping its
+// status. Payments never move to another organisation.
+func save(tx Repo, r *http.Request, ifMatch Precondition, found *RepoItem, p *Payment) (*Payment, error) {
+	if p.Organisation != found.Organisation {
+		return nil, &statusError{http.StatusUnprocessableEntity, ValidationErrors{{Pointer: "/data/organisation_id", Code: CodeReadOnly, Detail: "The organisation of a payment cannot be changed"}}}
+	}
+
+	if ifMatch.Present {
+		p.Version = found.Version
+	}
+
+	status := Status(found.Status)
+	if !status.Editable() {
+		return nil, &statusError{http.StatusConflict, fmt.Errorf("a %s payment can no longer be modified", status)}
+	}
+
+	p.Status = status
+	repoItem, err := p.ToRepoItem()
+	if err != nil {
+		return nil, &statusError{http.StatusInternalServerError, err}
+	}
+	repoItem.CreatedAt, repoItem.DeletedAt = found.CreatedAt, found.DeletedAt
+	repoItem.Audit = AuditOf(r)
+
+	updatedItem, err := tx.Update(r.Context(), repoItem)
+	if err != nil {
+		return nil, writeError(ifMatch, err)
+	}
+
 	p, err = NewPaymentFromRepoItem(updatedItem)
 	if err != nil {
-		HandleHttpError(w, r, http.StatusBadRequest, err)
-		return
+		return nil, &statusError{http.StatusInternalServerError, err}
 	}
+	return p, nil
+}
 
+// renderPayment answers with a payment, and its ETag.
+func (s *PaymentsService) renderPayment(w http.ResponseWriter, r *http.Request, p *Payment) {
 	links := make(Links)
-	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
+	links["self"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, p.Id))
 
+	SetETag(w, p.Version)
 	RenderJSON(w, r, http.StatusOK, &PaymentResponse{
 		Data:  p,
 		Links: links,
 	})
 }
 
-func decodePayment(r *http.Request) (*Payment, error) {
-	decoder := json.NewDecoder(r.Body)
+// Transition returns a handler moving payments into the next status, as
+// long as their current status allows it.
+func (s *PaymentsService) Transition(next Status) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		var p *Payment
+		err := s.repo.WithTx(r.Context(), func(tx Repo) error {
+			found, err := tx.Fetch(r.Context(), &RepoItem{Id: id})
+			if err != nil {
+				return err
+			}
+
+			p, err = NewPaymentFromRepoItem(found)
+			if err != nil {
+				return &statusError{http.StatusInternalServerError, err}
+			}
+
+			p.Status, err = p.Status.TransitionTo(next)
+			if err != nil {
+				return &statusError{http.StatusConflict, err}
+			}
+
+			repoItem, err := p.ToRepoItem()
+			if err != nil {
+				return &statusError{http.StatusInternalServerError, err}
+			}
+
+			repoItem.Audit = AuditOf(r)
+			updatedItem, err := tx.Update(r.Context(), repoItem)
+			if err != nil {
+				return err
+			}
+
+			p, err = NewPaymentFromRepoItem(updatedItem)
+			if err != nil {
+				return &statusError{http.StatusInternalServerError, err}
+			}
+			return nil
+		})
+		if err != nil {
+			handleError(w, r, err)
+			return
+		}
+
+		s.renderPayment(w, r, p)
+	}
+}
+
+// checkPreconditionPresent rejects unconditional writes, when the service
+// is configured to require If-Match.
+func (s *PaymentsService) checkPreconditionPresent(w http.ResponseWriter, r *http.Request, ifMatch Precondition) bool {
+	if s.requireIfMatch && !ifMatch.Present {
+		HandleHttpError(w, r, http.StatusPreconditionRequired, ErrPreconditionRequired)
+		return false
+	}
+	return true
+}
+
+// checkIfMatch rejects conditional writes to a payment whose ETag changed.
+func checkIfMatch(ifMatch Precondition, found *RepoItem) error {
+	if ifMatch.Present && !ifMatch.Matches(found.Version) {
+		return &statusError{http.StatusPreconditionFailed, ErrPreconditionFailed}
+	}
+	return nil
+}
+
+// writeError reports version conflicts on conditional writes as a failed
+// precondition.
+func writeError(ifMatch Precondition, err error) error {
+	if ifMatch.Present && IsConflict(err) {
+		return &statusError{http.StatusPreconditionFailed, ErrPreconditionFailed}
+	}
+	return err
+}
+
+// statusError tells the status to answer with, when a request fails within
+// a transaction for reasons other than a repo error.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Cause() error {
+	return e.err
+}
+
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if se, ok := err.(*statusError); ok {
+		HandleHttpError(w, r, se.status, se.err)
+		return
+	}
+	HandleRepoError(w, r, err)
+}
+
+func organisationFromBody(r *http.Request, body []byte) (string, error) {
+	var pr PaymentRequest
+	err := json.Unmarshal(body, &pr)
+	if err != nil {
+		return "", err
+	}
+	if pr.Payment == nil {
+		return "", fmt.Errorf("Payment data is missing")
+	}
+	return pr.Payment.Organisation, nil
+}
+
+func (s *PaymentsService) organisationFromRepo(r *http.Request, body []byte) (string, error) {
+	found, err := s.repo.Fetch(r.Context(), &RepoItem{Id: chi.URLParam(r, "id")})
+	if err != nil {
+		return "", err
+	}
+	return found.Organisation, nil
+}
+
+func decodePayment(body io.Reader) (*Payment, error) {
+	decoder := json.NewDecoder(body)
 	var pr PaymentRequest
 	err := decoder.Decode(&pr)
+	if err == nil && pr.Payment == nil {
+		err = ValidationErrors{{Pointer: "/data", Code: CodeRequired, Detail: "Payment data is missing"}}
+	}
 	return pr.Payment, err
 }
@@ -0,0 +1,80 @@
+package payments
+
+import (
+	"fmt"
+)
+
+type Status string
+
+const (
+	StatusCreated         Status = "created"
+	StatusPendingApproval Status = "pending_approval"
+	StatusSubmitted       Status = "submitted"
+	StatusAccepted        Status = "accepted"
+	StatusRejected        Status = "rejected"
+	StatusSettled         Status = "settled"
+	StatusCancelled       Status = "cancelled"
+	StatusReturned        Status = "returned"
+)
+
+// transitions lists, for each status, the statuses a payment can move to.
+var transitions = map[Status][]Status{
+	StatusCreated:         {StatusPendingApproval, StatusCancelled},
+	StatusPendingApproval: {StatusSubmitted, StatusCancelled},
+	StatusSubmitted:       {StatusAccepted, StatusRejected},
+	StatusAccepted:        {StatusSettled},
+	StatusSettled:         {StatusReturned},
+}
+
+// Actions are exposed as POST /payments/{id}/{action} endpoints, each one
+// moving a payment into a new status.
+var Actions = map[string]Status{
+	"request-approval": StatusPendingApproval,
+	"submit":           StatusSubmitted,
+	"accept":           StatusAccepted,
+	"reject":           StatusRejected,
+	"settle":           StatusSettled,
+	"cancel":           StatusCancelled,
+	"return":           StatusReturned,
+}
+
+func (s Status) Valid() bool {
+	switch s {
+	case StatusCreated, StatusPendingApproval, StatusSubmitted, StatusAccepted,
+		StatusRejected, StatusSettled, StatusCancelled, StatusReturned:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, t := range transitions[s] {
+		if t == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Editable tells whether a payment can still be modified, which is no
+// longer the case once it has been submitted.
+func (s Status) Editable() bool {
+	return s == StatusCreated || s == StatusPendingApproval
+}
+
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("a %s payment cannot become %s", e.From, e.To)
+}
+
+func (s Status) TransitionTo(next Status) (Status, error) {
+	if !s.CanTransitionTo(next) {
+		return s, &TransitionError{From: s, To: next}
+	}
+	return next, nil
+}
@@ -0,0 +1,100 @@
+package payments
+
+import (
+	"fmt"
+	. "github.com/mfamador/go-payments-api/pkg/util"
+	"strings"
+)
+
+// Codes reported on each field error, so clients do not need to parse
+// error details.
+const (
+	CodeRequired        = "required"
+	CodeInvalid         = "invalid"
+	CodeNotPositive     = "not_positive"
+	CodeMismatch        = "mismatch"
+	CodeUnknownCurrency = "unknown_currency"
+	CodeTooPrecise      = "too_precise"
+	CodeReadOnly        = "read_only"
+)
+
+// Validator collects every violation found while validating a document.
+// Validators created with At share their errors with their parent, so
+// nested structures report their problems with full JSON pointers.
+type Validator struct {
+	path   string
+	errors *ValidationErrors
+}
+
+func NewValidator(path string) *Validator {
+	return &Validator{
+		path:   path,
+		errors: &ValidationErrors{},
+	}
+}
+
+func (v *Validator) At(field string) *Validator {
+	return &Validator{
+		path:   v.pointerTo(field),
+		errors: v.errors,
+	}
+}
+
+func (v *Validator) Index(i int) *Validator {
+	return v.At(fmt.Sprintf("%d", i))
+}
+
+func (v *Validator) Add(field string, code string, detail string) {
+	*v.errors = append(*v.errors, FieldError{
+		Pointer: v.pointerTo(field),
+		Code:    code,
+		Detail:  detail,
+	})
+}
+
+func (v *Validator) Check(ok bool, field string, code string, detail string) bool {
+	if !ok {
+		v.Add(field, code, detail)
+	}
+	return ok
+}
+
+func (v *Validator) Required(field string, value string) bool {
+	return v.Check(len(strings.TrimSpace(value)) > 0, field, CodeRequired, fmt.Sprintf("%s is required", field))
+}
+
+// OneOf checks an optional value is one of the allowed ones.
+func (v *Validator) OneOf(field string, value string, allowed ...string) bool {
+	if value == "" {
+		return true
+	}
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	v.Add(field, CodeInvalid, fmt.Sprintf("%s must be one of %s", field, strings.Join(allowed, ", ")))
+	return false
+}
+
+func (v *Validator) Valid() bool {
+	return len(*v.errors) == 0
+}
+
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+	return *v.errors
+}
+
+func (v *Validator) pointerTo(field string) string {
+	if field == "" {
+		return v.path
+	}
+	return v.path + "/" + escapePointerToken(field)
+}
+
+func escapePointerToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
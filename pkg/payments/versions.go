@@ -0,0 +1,212 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	. "github.com/mfamador/go-payments-api/pkg/util"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ActorHeader names who is making a request, as recorded in the history of
+// the payments it writes. It is asserted by the client, and not checked:
+// the request id recorded along with it is the server's own.
+const ActorHeader = "X-Actor"
+
+var (
+	versionsLinkPattern string
+	versionLinkPattern  string
+)
+
+func init() {
+	versionsLinkPattern = "/payments/%v/versions"
+	versionLinkPattern = "/payments/%v/versions/%v"
+}
+
+// PaymentVersion is a snapshot of a payment, recorded after an operation.
+type PaymentVersion struct {
+	Version    int       `json:"version"`
+	Operation  string    `json:"operation"`
+	Actor      string    `json:"actor,omitempty"`
+	RequestId  string    `json:"request_id,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Payment    *Payment  `json:"payment"`
+}
+
+type PaymentVersionResponse struct {
+	Data  *PaymentVersion `json:"data"`
+	Links Links           `json:"links"`
+}
+
+type PaymentVersionsResponse struct {
+	Data  []*PaymentVersion `json:"data"`
+	Links Links             `json:"links"`
+}
+
+func AuditOf(r *http.Request) RepoAudit {
+	return RepoAudit{
+		Actor:     r.Header.Get(ActorHeader),
+		RequestId: RequestId(r),
+	}
+}
+
+func NewPaymentVersion(v *RepoVersion) (*PaymentVersion, error) {
+	p, err := NewPaymentFromRepoItem(&v.Item)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentVersion{
+		Version:    v.Item.Version,
+		Operation:  v.Operation,
+		Actor:      v.Item.Audit.Actor,
+		RequestId:  v.Item.Audit.RequestId,
+		RecordedAt: *timeOf(v.RecordedAt),
+		Payment:    p,
+	}, nil
+}
+
+// findVersion returns the payment as it was at a version. Deletes record
+// a version of their own, but histories recorded before they did hold a
+// delete at the version of the last update: the first snapshot is kept.
+func findVersion(history []*RepoVersion, version int) (*RepoVersion, bool) {
+	for _, v := range history {
+		if v.Item.Version == version {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// previousVersion is the version of the snapshot recorded before the one
+// at a version, or that version itself when none was.
+func previousVersion(history []*RepoVersion, version int) int {
+	previous := version
+	for _, v := range history {
+		if v.Item.Version >= version {
+			break
+		}
+		previous = v.Item.Version
+	}
+	return previous
+}
+
+func (s *PaymentsService) Versions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	history, err := s.repo.History(r.Context(), id)
+	if err != nil {
+		HandleRepoError(w, r, err)
+		return
+	}
+
+	versions := []*PaymentVersion{}
+	for _, v := range history {
+		pv, err := NewPaymentVersion(v)
+		if err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		versions = append(versions, pv)
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(versionsLinkPattern, id))
+	links["payment"] = s.UrlFor(fmt.Sprintf(paymentLinkPattern, id))
+
+	RenderJSON(w, r, http.StatusOK, &PaymentVersionsResponse{
+		Data:  versions,
+		Links: links,
+	})
+}
+
+func (s *PaymentsService) Version(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		HandleHttpError(w, r, http.StatusBadRequest, fmt.Errorf("Invalid version: %s", chi.URLParam(r, "version")))
+		return
+	}
+
+	history, err := s.repo.History(r.Context(), id)
+	if err != nil {
+		HandleRepoError(w, r, err)
+		return
+	}
+
+	found, ok := findVersion(history, version)
+	if !ok {
+		HandleHttpError(w, r, http.StatusNotFound, fmt.Errorf("version %d of payment %s not found", version, id))
+		return
+	}
+
+	pv, err := NewPaymentVersion(found)
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	links := make(Links)
+	links["self"] = s.UrlFor(fmt.Sprintf(versionLinkPattern, id, version))
+	links["versions"] = s.UrlFor(fmt.Sprintf(versionsLinkPattern, id))
+
+	RenderJSON(w, r, http.StatusOK, &PaymentVersionResponse{
+		Data:  pv,
+		Links: links,
+	})
+}
+
+// Diff returns the JSON Patch turning a version of a payment into another
+// one: from the one recorded before the latest one to the latest one,
+// unless the from and to query params say otherwise.
+func (s *PaymentsService) Diff(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	history, err := s.repo.History(r.Context(), id)
+	if err != nil {
+		HandleRepoError(w, r, err)
+		return
+	}
+
+	var errs ValidationErrors
+	versionParam := func(param string, def int) int {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			return def
+		}
+		version, err := strconv.Atoi(value)
+		if err != nil || version < 0 {
+			errs = append(errs, FieldError{Parameter: param, Code: CodeInvalid, Detail: fmt.Sprintf("Invalid version: %s", value)})
+		}
+		return version
+	}
+	to := versionParam("to", history[len(history)-1].Item.Version)
+	from := versionParam("from", previousVersion(history, to))
+	if len(errs) > 0 {
+		HandleHttpError(w, r, http.StatusBadRequest, errs)
+		return
+	}
+
+	docs := make([][]byte, 2)
+	for i, version := range []int{from, to} {
+		found, ok := findVersion(history, version)
+		if !ok {
+			HandleHttpError(w, r, http.StatusNotFound, fmt.Errorf("version %d of payment %s not found", version, id))
+			return
+		}
+		p, err := NewPaymentFromRepoItem(&found.Item)
+		if err == nil {
+			docs[i], err = json.Marshal(&PaymentRequest{Payment: p})
+		}
+		if err != nil {
+			HandleHttpError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	patch, err := Diff(docs[0], docs[1])
+	if err != nil {
+		HandleHttpError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	RenderJSONPatch(w, r, http.StatusOK, patch)
+}
@@ -11,9 +11,10 @@ import (
 
 type Client struct {
 	ServerUrl string
+	Headers   map[string]string
 	http      *httpclient.HttpClient
 	Resp      *httpclient.Response
-	Json      map[string]interface{}
+	Json      interface{}
 	Text      string
 	Err       error
 }
@@ -22,6 +23,7 @@ func NewClient(serverUrl string) *Client {
 	return &Client{
 		http:      httpclient.NewHttpClient(),
 		ServerUrl: serverUrl,
+		Headers:   make(map[string]string),
 	}
 }
 
@@ -31,7 +33,7 @@ func (c *Client) UrlFor(path string) string {
 
 func (c *Client) Get(path string) {
 	url := c.UrlFor(path)
-	res, err := c.http.Get(url)
+	res, err := c.http.WithHeaders(c.Headers).Get(url)
 	c.Resp = res
 	c.Err = err
 	c.parseResponse()
@@ -39,7 +41,7 @@ func (c *Client) Get(path string) {
 
 func (c *Client) Delete(path string) {
 	url := c.UrlFor(path)
-	res, err := c.http.Delete(url)
+	res, err := c.http.WithHeaders(c.Headers).Delete(url)
 	c.Resp = res
 	c.Err = err
 	c.parseResponse()
@@ -47,7 +49,7 @@ func (c *Client) Delete(path string) {
 
 func (c *Client) Post(path string, data string) {
 	url := c.UrlFor(path)
-	res, err := c.http.PostJson(url, data)
+	res, err := c.http.WithHeaders(c.Headers).PostJson(url, data)
 	c.Resp = res
 	c.Err = err
 	c.parseResponse()
@@ -55,7 +57,15 @@ func (c *Client) Post(path string, data string) {
 
 func (c *Client) Put(path string, data string) {
 	url := c.UrlFor(path)
-	res, err := c.http.PutJson(url, data)
+	res, err := c.http.WithHeaders(c.Headers).PutJson(url, data)
+	c.Resp = res
+	c.Err = err
+	c.parseResponse()
+}
+
+func (c *Client) Patch(path string, contentType string, data string) {
+	url := c.UrlFor(path)
+	res, err := c.http.WithHeaders(c.Headers).Do("PATCH", url, map[string]string{"Content-Type": contentType}, strings.NewReader(data))
 	c.Resp = res
 	c.Err = err
 	c.parseResponse()
@@ -81,10 +91,10 @@ func (c *Client) parseResponse() {
 }
 
 func (c *Client) maybeParseJson(bytes []byte) {
-	var anyJson map[string]interface{}
+	var anyJson interface{}
 	err := json.Unmarshal(bytes, &anyJson)
 	if err != nil {
-		log.Info("Could not unmarshal json: %v", string(bytes))
+		log.Infof("Could not unmarshal json: %v", string(bytes))
 	} else {
 		c.Json = anyJson
 	}
@@ -95,7 +105,11 @@ func (c *Client) maybeParseText(bytes []byte) {
 }
 
 func (c *Client) HasJson() bool {
-	return c.Resp != nil && strings.Contains(c.Resp.Header.Get("content-type"), "application/json")
+	if c.Resp == nil {
+		return false
+	}
+	contentType := c.Resp.Header.Get("content-type")
+	return strings.Contains(contentType, "application/json") || strings.Contains(contentType, "+json")
 }
 
 func (c *Client) HasText() bool {
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/mdaverde/jsonpath"
 	. "github.com/smartystreets/assertions"
+	"net/url"
 	"reflect"
+	"strings"
 )
 
 func (w *World) TheServiceIsUp() error {
@@ -41,6 +43,28 @@ func (w *World) TheRepoShouldHaveItems(expected int) error {
 	})
 }
 
+func (w *World) IGetTheDeletedPayments() error {
+	w.Client.Get("/admin/payments/deleted")
+	return nil
+}
+
+func (w *World) IGetTheDeletedPaymentsWith(query string) error {
+	w.Client.Get("/admin/payments/deleted?" + query)
+	return nil
+}
+
+func (w *World) IUndeleteThatPayment() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Client.Post(fmt.Sprintf("/admin/payments/%s/undelete", w.Data.PaymentData.Id), "")
+		return nil
+	})
+}
+
+func (w *World) IPurgePaymentsDeletedMoreThanAgo(olderThan string) error {
+	w.Client.Post("/admin/payments/purge?older_than="+olderThan, "")
+	return nil
+}
+
 func (w *World) IQueryTheHealthEndpoint() error {
 	w.Client.Get("/health")
 	return nil
@@ -61,6 +85,11 @@ func (w *World) IGetPaymentsFromTo(from int, to int) error {
 	return nil
 }
 
+func (w *World) IGetPaymentsWith(query string) error {
+	w.Client.Get(w.versionedPath("/payments?" + query))
+	return nil
+}
+
 func (w *World) IQueryTheMetricsEndpoint() error {
 	w.Client.Get("/metrics")
 	return nil
@@ -74,6 +103,31 @@ func (w *World) IShouldHaveStatusCode(expected int) error {
 	})
 }
 
+func (w *World) IUseIdempotencyKey(key string) error {
+	w.Client.Headers["Idempotency-Key"] = key
+	return nil
+}
+
+func (w *World) IUseHeader(name string, value string) error {
+	w.Client.Headers[name] = value
+	return nil
+}
+
+func (w *World) IShouldHaveHeader(name string, expected string) error {
+	return ExpectThen(ShouldNotBeNil(w.Client.Resp), func() error {
+		return Expect(ShouldEqual(w.Client.Resp.Header.Get(name), expected))
+	})
+}
+
+func (w *World) IShouldHaveTheLocationOfThatJson() error {
+	return ExpectThen(ShouldNotBeNil(w.Data.Subject), func() error {
+		id, err := jsonpath.Get(w.Data.Subject, "data.id")
+		return ExpectThen(ShouldBeNil(err), func() error {
+			return w.IShouldHaveHeader("Location", w.Client.UrlFor(w.versionedPath(fmt.Sprintf("/payments/%v", id))))
+		})
+	})
+}
+
 func (w *World) IShouldHaveContentType(expected string) error {
 	return ExpectThen(ShouldNotBeNil(w.Client.Resp), func() error {
 		return Expect(ShouldContainSubstring(w.Client.Resp.Header.Get("content-type"), expected))
@@ -81,7 +135,7 @@ func (w *World) IShouldHaveContentType(expected string) error {
 }
 
 func (w *World) IShouldHaveAJson() error {
-	return DoThen(w.IShouldHaveContentType("application/json"), func() error {
+	return ExpectThen(ShouldBeTrue(w.Client.HasJson()), func() error {
 		return ExpectThen(ShouldNotBeNil(w.Client.Json), func() error {
 			w.Data.Subject = w.Client.Json
 			return nil
@@ -89,6 +143,12 @@ func (w *World) IShouldHaveAJson() error {
 	})
 }
 
+func (w *World) IShouldHaveAProblem() error {
+	return DoThen(w.IShouldHaveContentType("application/problem+json"), func() error {
+		return w.IShouldHaveAJson()
+	})
+}
+
 func (w *World) IShouldHaveAText() error {
 	return ExpectThen(ShouldNotBeNil(w.Client.Text), func() error {
 		w.Data.Subject = w.Client.Text
@@ -105,6 +165,15 @@ func (w *World) ThatJsonShouldHaveString(path string, expected string) error {
 	})
 }
 
+func (w *World) ThatJsonShouldHaveStringOtherThan(path string, unexpected string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.Subject), func() error {
+		actual, err := jsonpath.Get(w.Data.Subject, path)
+		return ExpectThen(ShouldBeNil(err), func() error {
+			return Expect(ShouldNotEqual(actual, unexpected))
+		})
+	})
+}
+
 func (w *World) ThatJsonShouldHaveInt(path string, expected int) error {
 	return ExpectThen(ShouldNotBeNil(w.Data.Subject), func() error {
 		actual, err := jsonpath.Get(w.Data.Subject, path)
@@ -114,6 +183,15 @@ func (w *World) ThatJsonShouldHaveInt(path string, expected int) error {
 	})
 }
 
+func (w *World) ThatJsonShouldHaveBool(path string, expected string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.Subject), func() error {
+		actual, err := jsonpath.Get(w.Data.Subject, path)
+		return ExpectThen(ShouldBeNil(err), func() error {
+			return Expect(ShouldEqual(actual, expected == "true"))
+		})
+	})
+}
+
 func (w *World) ThatTextShouldMatch(expected string) error {
 	return ExpectThen(ShouldNotBeNil(w.Data.Subject), func() error {
 		var text string
@@ -125,8 +203,12 @@ func (w *World) ThatTextShouldMatch(expected string) error {
 }
 
 func (w *World) ThatJsonShouldHaveItems(expected int) error {
+	return w.ThatJsonShouldHaveItemsAt(expected, "data")
+}
+
+func (w *World) ThatJsonShouldHaveItemsAt(expected int, path string) error {
 	return ExpectThen(ShouldNotBeNil(w.Data.Subject), func() error {
-		actual, err := jsonpath.Get(w.Data.Subject, "data")
+		actual, err := jsonpath.Get(w.Data.Subject, path)
 		return ExpectThen(ShouldBeNil(err), func() error {
 			var items []interface{}
 			return ExpectThen(ShouldEqual(reflect.TypeOf(actual), reflect.TypeOf(items)), func() error {
@@ -148,21 +230,67 @@ func (w *World) ThatJsonShouldHaveA(path string) error {
 	})
 }
 
+func (w *World) ThatJsonShouldNotHaveA(path string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.Subject), func() error {
+		actual, _ := jsonpath.Get(w.Data.Subject, path)
+		return Expect(ShouldBeNil(actual))
+	})
+}
+
+func (w *World) IFollowTheLink(name string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.Subject), func() error {
+		link, err := jsonpath.Get(w.Data.Subject, "links."+name)
+		return ExpectThen(ShouldBeNil(err), func() error {
+			u, err := url.Parse(fmt.Sprintf("%v", link))
+			return ExpectThen(ShouldBeNil(err), func() error {
+				w.Client.Get(u.RequestURI())
+				return nil
+			})
+		})
+	})
+}
+
 func (w *World) APaymentWithId(id string) error {
 	w.Data.PaymentData = &PaymentData{
 		Id:           id,
 		Version:      0,
 		Organisation: "org1",
 		Amount:       "1.00",
+		Currency:     "GBP",
 	}
 	return nil
 }
 
+func (w *World) APaymentWithoutId() error {
+	return w.APaymentWithId("")
+}
+
+func (w *World) IFollowTheLocationHeader() error {
+	return ExpectThen(ShouldNotBeNil(w.Client.Resp), func() error {
+		location, err := url.Parse(w.Client.Resp.Header.Get("Location"))
+		return ExpectThen(ShouldBeNil(err), func() error {
+			w.Client.Get(location.Path)
+			return nil
+		})
+	})
+}
+
 func (w *World) APaymentWithIdNoOrganisation(id string) error {
 	w.Data.PaymentData = &PaymentData{
-		Id:      id,
-		Version: 0,
-		Amount:  "1.00",
+		Id:       id,
+		Version:  0,
+		Amount:   "1.00",
+		Currency: "GBP",
+	}
+	return nil
+}
+
+func (w *World) APaymentWithIdAmountNoOrganisation(id string, amount string) error {
+	w.Data.PaymentData = &PaymentData{
+		Id:       id,
+		Version:  0,
+		Amount:   amount,
+		Currency: "GBP",
 	}
 	return nil
 }
@@ -173,10 +301,50 @@ func (w *World) APaymentWithIdAmount(id string, amount string) error {
 		Version:      0,
 		Organisation: "org1",
 		Amount:       amount,
+		Currency:     "GBP",
 	}
 	return nil
 }
 
+func (w *World) ACompletePaymentWithId(id string) error {
+	return DoThen(w.APaymentWithId(id), func() error {
+		w.Data.PaymentData.Details = FullPaymentDetails
+		return nil
+	})
+}
+
+func (w *World) APaymentWithIdAndInvalidDetails(id string) error {
+	return DoThen(w.APaymentWithId(id), func() error {
+		w.Data.PaymentData.Details = InvalidPaymentDetails
+		return nil
+	})
+}
+
+func (w *World) APaymentWithIdAmountCurrency(id string, amount string, currency string) error {
+	w.Data.PaymentData = &PaymentData{
+		Id:           id,
+		Version:      0,
+		Organisation: "org1",
+		Amount:       amount,
+		Currency:     currency,
+	}
+	return nil
+}
+
+func (w *World) ThatPaymentBelongsToOrganisation(organisation string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Organisation = organisation
+		return nil
+	})
+}
+
+func (w *World) ThatPaymentHasReference(reference string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		w.Data.PaymentData.Details = fmt.Sprintf(`"reference": %q`, reference)
+		return nil
+	})
+}
+
 func (w *World) ThatPaymentHasVersion(v int) error {
 	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
 		w.Data.PaymentData.Version = v
@@ -190,6 +358,58 @@ func (w *World) ICreateThatPayment() error {
 	return nil
 }
 
+func (w *World) ICreatedThatPayment() error {
+	return DoThen(w.ICreateThatPayment(), func() error {
+		return w.IShouldHaveStatusCode(201)
+	})
+}
+
+func (w *World) ABatchOfPaymentsWithIds(ids string) error {
+	w.Data.Batch = nil
+	for _, id := range strings.Split(ids, ",") {
+		err := w.APaymentWithId(id)
+		if err != nil {
+			return err
+		}
+		w.Data.Batch = append(w.Data.Batch, w.Data.PaymentData)
+	}
+	return nil
+}
+
+func (w *World) ABatchOfPaymentsWithoutIds(count int) error {
+	w.Data.Batch = nil
+	return DoSequence(func(it int) error {
+		return DoThen(w.APaymentWithoutId(), func() error {
+			w.Data.Batch = append(w.Data.Batch, w.Data.PaymentData)
+			return nil
+		})
+	}, count)
+}
+
+func (w *World) ThatBatchHasAPaymentWithoutOrganisationAndId(id string) error {
+	return DoThen(w.APaymentWithIdNoOrganisation(id), func() error {
+		w.Data.Batch = append(w.Data.Batch, w.Data.PaymentData)
+		return nil
+	})
+}
+
+// ICreateThatBatch leaves the first payment of the batch as that payment.
+func (w *World) ICreateThatBatch() error {
+	return ExpectThen(ShouldNotBeEmpty(w.Data.Batch), func() error {
+		w.Data.PaymentData = w.Data.Batch[0]
+		w.Client.Post(w.versionedPath("/payments/batch"), BatchToJSON(w.Data.Batch))
+		return nil
+	})
+}
+
+func (w *World) ICreateThatBatchInMode(mode string) error {
+	return ExpectThen(ShouldNotBeEmpty(w.Data.Batch), func() error {
+		w.Data.PaymentData = w.Data.Batch[0]
+		w.Client.Post(w.versionedPath("/payments/batch?mode="+mode), BatchToJSON(w.Data.Batch))
+		return nil
+	})
+}
+
 func (w *World) IUpdateThatPayment() error {
 	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
 		p := w.Data.PaymentData
@@ -199,6 +419,21 @@ func (w *World) IUpdateThatPayment() error {
 	})
 }
 
+func (w *World) IPatchThatPayment(contentType string, patch string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		p := w.Data.PaymentData
+		path := w.versionedPath(fmt.Sprintf("/payments/%s", p.Id))
+		w.Client.Patch(path, contentType, patch)
+		return nil
+	})
+}
+
+func (w *World) IPatchedThatPayment(contentType string, patch string) error {
+	return DoThen(w.IPatchThatPayment(contentType, patch), func() error {
+		return w.IShouldHaveStatusCode(200)
+	})
+}
+
 func (w *World) IUpdateVersionOfThatPayment(v int) error {
 	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
 		p := w.Data.PaymentData
@@ -207,6 +442,30 @@ func (w *World) IUpdateVersionOfThatPayment(v int) error {
 	})
 }
 
+func (w *World) IGetTheVersionsOfThatPayment() error {
+	return w.iGetFromThatPayment("/versions")
+}
+
+func (w *World) IGetVersionOfThatPayment(version int) error {
+	return w.iGetFromThatPayment(fmt.Sprintf("/versions/%d", version))
+}
+
+func (w *World) IGetTheDiffOfThatPayment() error {
+	return w.iGetFromThatPayment("/diff")
+}
+
+func (w *World) IGetTheDiffOfThatPaymentWith(query string) error {
+	return w.iGetFromThatPayment("/diff?" + query)
+}
+
+func (w *World) iGetFromThatPayment(subpath string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		p := w.Data.PaymentData
+		w.Client.Get(w.versionedPath(fmt.Sprintf("/payments/%s%s", p.Id, subpath)))
+		return nil
+	})
+}
+
 func (w *World) IGetThatPayment() error {
 	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
 		p := w.Data.PaymentData
@@ -273,6 +532,21 @@ func (w *World) IDeleteThatPaymentWithoutSayingWhichVersion() error {
 	})
 }
 
+func (w *World) IPerformOnThatPayment(action string) error {
+	return ExpectThen(ShouldNotBeNil(w.Data.PaymentData), func() error {
+		p := w.Data.PaymentData
+		path := w.versionedPath(fmt.Sprintf("/payments/%s/%s", p.Id, action))
+		w.Client.Post(path, "")
+		return nil
+	})
+}
+
+func (w *World) IPerformedOnThatPayment(action string) error {
+	return DoThen(w.IPerformOnThatPayment(action), func() error {
+		return w.IShouldHaveStatusCode(200)
+	})
+}
+
 func (w *World) IUpdatedThatPayment() error {
 	return DoThen(w.IUpdateThatPayment(), func() error {
 		return w.IShouldHaveStatusCode(200)
@@ -3,6 +3,7 @@ package test
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 func ExpectThen(msg string, next func() error) error {
@@ -44,24 +45,113 @@ type PaymentData struct {
 	Version      int
 	Organisation string
 	Amount       string
+	Currency     string
+	Details      string
 }
 
 func (p *PaymentData) ToJSON() string {
 	return fmt.Sprintf(`{ 
-		"data": {
+		"data": %s
+	}`, p.DataJSON())
+}
+
+// DataJSON is the payment itself, without the request envelope.
+func (p *PaymentData) DataJSON() string {
+	details := ""
+	if p.Details != "" {
+		details = "," + p.Details
+	}
+	return fmt.Sprintf(`{
 			"id": "%s",
 			"type": "Payment",
 			"version": %v,
 			"organisation_id": "%s",
 			"attributes": {
-				"amount": "%s"
+				"amount": "%s",
+				"currency": "%s"%s
 			}
-		}
-	}`, p.Id, p.Version, p.Organisation, p.Amount)
+		}`, p.Id, p.Version, p.Organisation, p.Amount, p.Currency, details)
 }
 
+// BatchToJSON is the request creating every payment of a batch.
+func BatchToJSON(batch []*PaymentData) string {
+	payments := make([]string, len(batch))
+	for i, p := range batch {
+		payments[i] = p.DataJSON()
+	}
+	return fmt.Sprintf(`{ "data": [%s] }`, strings.Join(payments, ", "))
+}
+
+// FullPaymentDetails holds every optional payment attribute, as found in
+// real world payments.
+const FullPaymentDetails = `
+	"beneficiary_party": {
+		"account_name": "W Owens",
+		"account_number": "31926819",
+		"account_number_code": "BBAN",
+		"account_type": 0,
+		"address": "1 The Beneficiary Localtown SE2",
+		"bank_id": "403000",
+		"bank_id_code": "GBDSC",
+		"name": "Wilfred Jeremiah Owens"
+	},
+	"debtor_party": {
+		"account_name": "EJ Brown Black",
+		"account_number": "GB29XABC10161234567801",
+		"account_number_code": "IBAN",
+		"address": "10 Debtor Crescent Sourcetown NE1",
+		"bank_id": "203301",
+		"bank_id_code": "GBDSC",
+		"name": "Emelia Jane Brown"
+	},
+	"sponsor_party": {
+		"account_number": "56781234",
+		"bank_id": "123123",
+		"bank_id_code": "GBDSC"
+	},
+	"charges_information": {
+		"bearer_code": "SHAR",
+		"sender_charges": [
+			{ "amount": "5", "currency": "GBP" },
+			{ "amount": "10.00", "currency": "USD" }
+		],
+		"receiver_charges_amount": "1.00",
+		"receiver_charges_currency": "USD"
+	},
+	"fx": {
+		"contract_reference": "FX123",
+		"exchange_rate": "2.00000",
+		"original_amount": "200.42",
+		"original_currency": "USD"
+	},
+	"end_to_end_reference": "Wil piano Jan",
+	"numeric_reference": "1002001",
+	"payment_id": "123456789012345678",
+	"payment_purpose": "Paying for goods/services",
+	"payment_scheme": "FPS",
+	"payment_type": "Credit",
+	"processing_date": "2017-01-18",
+	"reference": "Payment for Em's piano lessons",
+	"scheme_payment_sub_type": "InternetBanking",
+	"scheme_payment_type": "ImmediatePayment"`
+
+// InvalidPaymentDetails breaks one rule in each nested structure.
+const InvalidPaymentDetails = `
+	"beneficiary_party": {
+		"account_number": "31926819",
+		"bank_id_code": "GBDSC"
+	},
+	"charges_information": {
+		"bearer_code": "SHAR",
+		"sender_charges": [
+			{ "amount": "5.001", "currency": "GBP" }
+		]
+	},
+	"processing_date": "18/01/2017"`
+
 type ScenarioData struct {
 	PaymentData *PaymentData
+	Batch       []*PaymentData
 	Subject     interface{}
 }
 
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrPreconditionFailed   = errors.New("the resource was modified, its ETag no longer matches If-Match")
+	ErrPreconditionRequired = errors.New("this request must be made conditional with an If-Match header")
+)
+
+// ETag derives an entity tag from the version of a repo item.
+func ETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+func SetETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", ETag(version))
+}
+
+// Precondition holds the entity tags found in an If-Match or
+// If-None-Match header.
+type Precondition struct {
+	Present bool
+	Any     bool
+	tags    []string
+}
+
+func IfMatch(r *http.Request) Precondition {
+	return parsePrecondition(r.Header.Get("If-Match"))
+}
+
+func IfNoneMatch(r *http.Request) Precondition {
+	return parsePrecondition(r.Header.Get("If-None-Match"))
+}
+
+func parsePrecondition(header string) Precondition {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return Precondition{}
+	}
+	p := Precondition{Present: true}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			p.Any = true
+		}
+		p.tags = append(p.tags, tag)
+	}
+	return p
+}
+
+// Matches uses the strong comparison required by If-Match: weak tags never
+// match.
+func (p Precondition) Matches(version int) bool {
+	if p.Any {
+		return true
+	}
+	etag := ETag(version)
+	for _, tag := range p.tags {
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesWeak uses the weak comparison used by If-None-Match.
+func (p Precondition) MatchesWeak(version int) bool {
+	if p.Any {
+		return true
+	}
+	etag := ETag(version)
+	for _, tag := range p.tags {
+		if strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func RenderNotModified(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// NoCache sets the same response headers as chi's middleware.NoCache, but
+// keeps the conditional request headers our handlers rely on.
+func NoCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Expires", "Thu, 01 Jan 1970 00:00:00 UTC")
+		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+		w.Header().Set("Pragma", "no-cache")
+		w.Header().Set("X-Accel-Expires", "0")
+		next.ServeHTTP(w, r)
+	})
+}
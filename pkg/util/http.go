@@ -3,11 +3,14 @@ package util
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/go-chi/chi/middleware"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
 )
 
+const RequestIdHeader = "X-Request-Id"
+
 type HttpService struct {
 	BaseUrl string
 }
@@ -19,12 +22,37 @@ func (s *HttpService) UrlFor(path string) string {
 type EmptyResponse struct{}
 
 func HandleHttpError(w http.ResponseWriter, r *http.Request, status int, err error) {
-	RenderJSON(w, r, status, &EmptyResponse{})
-	log.Error(err)
+	renderWithContentType(w, r, ProblemContentType, status, NewProblem(r, status, err))
+	log.WithField("request_id", RequestId(r)).Error(err)
+}
+
+func HandleRepoError(w http.ResponseWriter, r *http.Request, err error) {
+	HandleHttpError(w, r, RepoErrorStatus(err), err)
+}
+
+func RepoErrorStatus(err error) int {
+	switch RepoErrorKind(err) {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrGone:
+		return http.StatusGone
+	case ErrConflict, ErrDuplicateId:
+		return http.StatusConflict
+	case ErrInvalid:
+		return http.StatusBadRequest
+	case ErrUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 func RenderJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+	renderWithContentType(w, r, "application/json", status, data)
+}
+
+func renderWithContentType(w http.ResponseWriter, r *http.Request, contentType string, status int, data interface{}) {
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
 	enc := json.NewEncoder(w)
 	enc.SetEscapeHTML(false)
@@ -38,6 +66,21 @@ func RenderNoContent(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// DropRequestIds removes the X-Request-Id header of incoming requests,
+// before the RequestID middleware takes it as their id: ids are always
+// assigned by the server, so the ones found in the logs and in the payment
+// history can be trusted.
+func DropRequestIds(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(RequestIdHeader)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func RequestId(r *http.Request) string {
+	return middleware.GetReqID(r.Context())
+}
+
 func IntFromStringOrDefault(actual string, defaultValue int) int {
 	if actual == "" {
 		return defaultValue
@@ -0,0 +1,220 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotencyRecordTries = 2
+)
+
+// replayedHeaders are the response headers kept along with the body, so
+// replays of a creation still point at the created payment.
+var replayedHeaders = []string{"Location", "ETag"}
+
+var (
+	ErrIdempotencyKeyTooLong  = errors.New("Idempotency-Key must have at most 255 characters")
+	ErrIdempotencyKeyReused   = errors.New("Idempotency-Key was already used for a different request")
+	ErrIdempotencyKeyInFlight = errors.New("a request with this Idempotency-Key is still being processed")
+)
+
+// IdempotencyScope returns the organisation a request belongs to, so the
+// same key can be used by different organisations.
+type IdempotencyScope func(r *http.Request, body []byte) (string, error)
+
+// Idempotency makes handlers honour the Idempotency-Key header: the first
+// response sent for a key is kept in the repo, and replayed for every
+// retry of the same request until it expires.
+type Idempotency struct {
+	repo Repo
+	ttl  time.Duration
+}
+
+func NewIdempotency(repo Repo, ttl time.Duration) *Idempotency {
+	return &Idempotency{repo: repo, ttl: ttl}
+}
+
+func (i *Idempotency) Handler(scope IdempotencyScope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			HandleHttpError(w, r, http.StatusBadRequest, ErrIdempotencyKeyTooLong)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			HandleHttpError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		organisation, err := scope(r, body)
+		if err != nil {
+			// the handler itself will reject the request
+			next(w, r)
+			return
+		}
+
+		record := &IdempotencyRecord{
+			Key:          key,
+			Organisation: organisation,
+			RequestHash:  requestHash(r, body),
+		}
+
+		found, err := i.reserve(r.Context(), record)
+		if err != nil {
+			HandleRepoError(w, r, err)
+			return
+		}
+
+		if found != nil {
+			i.replay(w, r, record, found)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			// a panicking handler is answered 500 by the recoverer, once this
+			// middleware has unwound, so its record is released here
+			if p := recover(); p != nil {
+				i.release(r, record)
+				panic(p)
+			}
+		}()
+		next(recorder, r)
+
+		if recorder.status >= http.StatusInternalServerError {
+			i.release(r, record)
+			return
+		}
+		record.StatusCode = recorder.status
+		record.ContentType = recorder.Header().Get("Content-Type")
+		record.Headers = keptHeaders(recorder.Header())
+		record.Body = recorder.body.String()
+		// the request is done, and its context maybe cancelled, but the
+		// record must not stay reserved until it expires
+		if err := i.repo.UpdateIdempotencyRecord(context.Background(), record); err != nil {
+			log.WithField("request_id", RequestId(r)).Error(err)
+		}
+	}
+}
+
+// release deletes the record reserved for a request which failed, so it
+// can be retried with the same key.
+func (i *Idempotency) release(r *http.Request, record *IdempotencyRecord) {
+	if err := i.repo.DeleteIdempotencyRecord(context.Background(), record.Key, record.Organisation); err != nil {
+		log.WithField("request_id", RequestId(r)).Error(err)
+	}
+}
+
+// reserve stores the record for a new key, or returns the record found
+// when the key was already used and has not expired yet.
+func (i *Idempotency) reserve(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	for try := 0; try < maxIdempotencyRecordTries; try++ {
+		now := time.Now()
+		record.ExpiresAt = Millis(now.Add(i.ttl))
+
+		err := i.repo.CreateIdempotencyRecord(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+		if !IsDuplicateId(err) {
+			return nil, err
+		}
+
+		found, err := i.repo.FetchIdempotencyRecord(ctx, record.Key, record.Organisation)
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if found.ExpiresAt > Millis(now) {
+			return found, nil
+		}
+
+		err = i.repo.DeleteIdempotencyRecord(ctx, record.Key, record.Organisation)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, NewRepoError(ErrConflict, "reserve idempotency key", nil)
+}
+
+func (i *Idempotency) replay(w http.ResponseWriter, r *http.Request, record *IdempotencyRecord, found *IdempotencyRecord) {
+	if found.RequestHash != record.RequestHash {
+		HandleHttpError(w, r, http.StatusUnprocessableEntity, ErrIdempotencyKeyReused)
+		return
+	}
+
+	if found.StatusCode == 0 {
+		HandleHttpError(w, r, http.StatusConflict, ErrIdempotencyKeyInFlight)
+		return
+	}
+
+	if found.ContentType != "" {
+		w.Header().Set("Content-Type", found.ContentType)
+	}
+	for name, value := range found.Headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(found.StatusCode)
+	w.Write([]byte(found.Body))
+}
+
+func keptHeaders(header http.Header) map[string]string {
+	kept := map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := header.Get(name); value != "" {
+			kept[name] = value
+		}
+	}
+	return kept
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func idempotentRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/v1/payments", strings.NewReader(`{"data":{}}`))
+	r.Header.Set(IdempotencyKeyHeader, "key1")
+	return r
+}
+
+func org1(r *http.Request, body []byte) (string, error) {
+	return "org1", nil
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	repo, _ := NewMemoryRepo(RepoConfig{})
+	idempotency := NewIdempotency(repo, time.Hour)
+	calls := 0
+	handler := idempotency.Handler(org1, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", "/v1/payments/abc")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"data":{"id":"abc"}}`))
+	})
+
+	for try := 0; try < 2; try++ {
+		w := httptest.NewRecorder()
+		handler(w, idempotentRequest())
+		if w.Code != http.StatusCreated || w.Header().Get("Location") != "/v1/payments/abc" {
+			t.Errorf("try %d: expected 201 with its location, got %d %q", try, w.Code, w.Header().Get("Location"))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the handler to run once, ran %d times", calls)
+	}
+
+	record, err := repo.FetchIdempotencyRecord(context.Background(), "key1", "org1")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expiresIn := record.ExpiresAt - NowMillis(); expiresIn <= 0 || expiresIn > int64(time.Hour/time.Millisecond) {
+		t.Errorf("expected the record to expire within an hour, expires in %dms", expiresIn)
+	}
+}
+
+func TestIdempotencyPanic(t *testing.T) {
+	repo, _ := NewMemoryRepo(RepoConfig{})
+	idempotency := NewIdempotency(repo, time.Hour)
+	panicking := idempotency.Handler(org1, func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("expected the panic to go on, got %v", p)
+			}
+		}()
+		panicking(httptest.NewRecorder(), idempotentRequest())
+	}()
+
+	if _, err := repo.FetchIdempotencyRecord(context.Background(), "key1", "org1"); !IsNotFound(err) {
+		t.Errorf("expected the record to be released, got %v", err)
+	}
+
+	retried := idempotency.Handler(org1, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	w := httptest.NewRecorder()
+	retried(w, idempotentRequest())
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected the retry to be processed, got %d", w.Code)
+	}
+}
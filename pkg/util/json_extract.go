@@ -0,0 +1,40 @@
+package util
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// jsonExtract supports the subset of json_extract we rely on: paths made of
+// object members (eg. $.a.b), returning scalars as text, and an empty
+// string when the member is missing.
+func jsonExtract(doc string, path string) string {
+	var v interface{}
+	if json.Unmarshal([]byte(doc), &v) != nil || !strings.HasPrefix(path, "$") {
+		return ""
+	}
+	for _, key := range strings.Split(path, ".")[1:] {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = obj[key]
+	}
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		if value {
+			return "1"
+		}
+		return "0"
+	default:
+		b, _ := json.Marshal(value)
+		return string(b)
+	}
+}
@@ -0,0 +1,436 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	ErrUnsupportedPatch = errors.New("patches must be sent as " + MergePatchContentType + " or " + JSONPatchContentType)
+	ErrPatchTestFailed  = errors.New("a test operation of the patch failed")
+)
+
+// Patch applies a patch to a JSON document, returning the patched document.
+type Patch func(doc []byte, patch []byte) ([]byte, error)
+
+// PatchFor returns the patch format matching a request Content-Type.
+func PatchFor(contentType string) (Patch, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedPatch
+	}
+	switch mediaType {
+	case MergePatchContentType:
+		return MergePatch, nil
+	case JSONPatchContentType:
+		return JSONPatch, nil
+	default:
+		return nil, ErrUnsupportedPatch
+	}
+}
+
+func PatchErrorStatus(err error) int {
+	switch errors.Cause(err) {
+	case ErrUnsupportedPatch:
+		return http.StatusUnsupportedMediaType
+	case ErrPatchTestFailed:
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// MergePatch applies a JSON Merge Patch (RFC 7396): objects are merged
+// recursively, null removes a member, anything else replaces it.
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	target, err := decodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decodeJSON(patch)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid merge patch")
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies a JSON Patch (RFC 6902). Operations are applied in
+// order, and the whole patch fails if any of them does.
+func JSONPatch(doc []byte, patch []byte) ([]byte, error) {
+	target, err := decodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []patchOperation
+	err = json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid json patch")
+	}
+
+	for i, op := range ops {
+		target, err = op.apply(target)
+		if err != nil {
+			return nil, errors.Wrapf(err, "operation %d (%s)", i, op.Op)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func (op patchOperation) apply(doc interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, errors.New("path is missing")
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, errors.New("value is missing")
+		}
+		value, err := decodeJSON(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return addAt(doc, path, value)
+		case "replace":
+			if len(path) == 0 {
+				return value, nil
+			}
+			doc, _, err = removeAt(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			return addAt(doc, path, value)
+		default:
+			found, err := getAt(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(found, value) {
+				return nil, ErrPatchTestFailed
+			}
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err = removeAt(doc, path)
+		return doc, err
+	case "move", "copy":
+		if op.From == nil {
+			return nil, errors.New("from is missing")
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if op.Op == "move" {
+			if *op.Path != *op.From && strings.HasPrefix(*op.Path, *op.From+"/") {
+				return nil, errors.New("cannot move a value into one of its children")
+			}
+			doc, value, err = removeAt(doc, from)
+		} else {
+			value, err = getAt(doc, from)
+			if err == nil {
+				value, err = copyJSON(value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return addAt(doc, path, value)
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+type diffOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Diff returns the JSON Patch turning a document into another one. Object
+// members are compared recursively, in key order, while any other changed
+// value (including arrays) is replaced as a whole.
+func Diff(from []byte, to []byte) (json.RawMessage, error) {
+	a, err := decodeJSON(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decodeJSON(to)
+	if err != nil {
+		return nil, err
+	}
+	ops := []diffOperation{}
+	err = diff(&ops, "", a, b)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ops)
+}
+
+func diff(ops *[]diffOperation, path string, a interface{}, b interface{}) error {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	op := func(name string, path string, value interface{}) error {
+		o := diffOperation{Op: name, Path: path}
+		if name != "remove" {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			o.Value = data
+		}
+		*ops = append(*ops, o)
+		return nil
+	}
+
+	ma, okA := a.(map[string]interface{})
+	mb, okB := b.(map[string]interface{})
+	if !okA || !okB {
+		return op("replace", path, b)
+	}
+
+	keys := make([]string, 0, len(ma)+len(mb))
+	for k := range ma {
+		keys = append(keys, k)
+	}
+	for k := range mb {
+		if _, ok := ma[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		child := path + "/" + escapePointer(k)
+		va, inA := ma[k]
+		vb, inB := mb[k]
+		var err error
+		switch {
+		case !inB:
+			err = op("remove", child, nil)
+		case !inA:
+			err = op("add", child, vb)
+		default:
+			err = diff(ops, child, va, vb)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// RenderJSONPatch renders a JSON Patch, such as a Diff.
+func RenderJSONPatch(w http.ResponseWriter, r *http.Request, status int, patch json.RawMessage) {
+	renderWithContentType(w, r, JSONPatchContentType, status, patch)
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func getAt(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := doc.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path not found: %q", token)
+			}
+			doc = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = n[i]
+		default:
+			return nil, fmt.Errorf("path not found: %q", token)
+		}
+	}
+	return doc, nil
+}
+
+func addAt(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			n[key] = value
+			return n, nil
+		case []interface{}:
+			if key == "-" {
+				return append(n, value), nil
+			}
+			i, err := arrayIndex(key, len(n))
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar value", key)
+		}
+	})
+}
+
+func removeAt(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed interface{}
+	doc, err := updateParent(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			value, ok := n[key]
+			if !ok {
+				return nil, fmt.Errorf("path not found: %q", key)
+			}
+			removed = value
+			delete(n, key)
+			return n, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = n[i]
+			return append(n[:i], n[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("path not found: %q", key)
+		}
+	})
+	return doc, removed, err
+}
+
+// updateParent walks down to the container holding the last token of path,
+// and stores back whatever update returns, as arrays may be reallocated.
+func updateParent(doc interface{}, path []string, update func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+	switch n := doc.(type) {
+	case map[string]interface{}:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("path not found: %q", path[0])
+		}
+		updated, err := updateParent(child, path[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = updated
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := updateParent(n[i], path[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("path not found: %q", path[0])
+	}
+}
+
+// arrayIndex parses an array index, made of digits only and without
+// leading zeros, up to max.
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || token[0] < '0' || token[0] > '9' || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+func copyJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(data)
+}
@@ -0,0 +1,323 @@
+package util
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+)
+
+// The examples of RFC 6902 (appendix A), and a few more edge cases.
+var jsonPatchTests = []struct {
+	name     string
+	doc      string
+	patch    string
+	expected string
+	err      error
+}{
+	{
+		name:     "A.1 adding an object member",
+		doc:      `{"foo": "bar"}`,
+		patch:    `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+		expected: `{"baz": "qux", "foo": "bar"}`,
+	},
+	{
+		name:     "A.2 adding an array element",
+		doc:      `{"foo": ["bar", "baz"]}`,
+		patch:    `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+		expected: `{"foo": ["bar", "qux", "baz"]}`,
+	},
+	{
+		name:     "A.3 removing an object member",
+		doc:      `{"baz": "qux", "foo": "bar"}`,
+		patch:    `[{"op": "remove", "path": "/baz"}]`,
+		expected: `{"foo": "bar"}`,
+	},
+	{
+		name:     "A.4 removing an array element",
+		doc:      `{"foo": ["bar", "qux", "baz"]}`,
+		patch:    `[{"op": "remove", "path": "/foo/1"}]`,
+		expected: `{"foo": ["bar", "baz"]}`,
+	},
+	{
+		name:     "A.5 replacing a value",
+		doc:      `{"baz": "qux", "foo": "bar"}`,
+		patch:    `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+		expected: `{"baz": "boo", "foo": "bar"}`,
+	},
+	{
+		name:     "A.6 moving a value",
+		doc:      `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+		patch:    `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+		expected: `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+	},
+	{
+		name:     "A.7 moving an array element",
+		doc:      `{"foo": ["all", "grass", "cows", "eats"]}`,
+		patch:    `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+		expected: `{"foo": ["all", "cows", "eats", "grass"]}`,
+	},
+	{
+		name: "A.8 testing a value: success",
+		doc:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		patch: `[{"op": "test", "path": "/baz", "value": "qux"},
+			{"op": "test", "path": "/foo/1", "value": 2}]`,
+		expected: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+	},
+	{
+		name:  "A.9 testing a value: error",
+		doc:   `{"baz": "qux"}`,
+		patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+		err:   ErrPatchTestFailed,
+	},
+	{
+		name:     "A.10 adding a nested member object",
+		doc:      `{"foo": "bar"}`,
+		patch:    `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+		expected: `{"foo": "bar", "child": {"grandchild": {}}}`,
+	},
+	{
+		name:     "A.11 ignoring unrecognized elements",
+		doc:      `{"foo": "bar"}`,
+		patch:    `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+		expected: `{"foo": "bar", "baz": "qux"}`,
+	},
+	{
+		name:  "A.12 adding to a nonexistent target",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "A.13 invalid JSON patch document",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz", "value": "qux", "op": "remove"}]`,
+		err:   errAny,
+	},
+	{
+		name: "A.14 ~ escape ordering",
+		doc:  `{"/": 9, "~1": 10}`,
+		patch: `[{"op": "test", "path": "/~01", "value": 10},
+			{"op": "test", "path": "/~1", "value": 9}]`,
+		expected: `{"/": 9, "~1": 10}`,
+	},
+	{
+		name:  "A.15 comparing strings and numbers",
+		doc:   `{"/": 9, "~1": 10}`,
+		patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+		err:   ErrPatchTestFailed,
+	},
+	{
+		name:     "A.16 adding an array value",
+		doc:      `{"foo": ["bar"]}`,
+		patch:    `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+		expected: `{"foo": ["bar", ["abc", "def"]]}`,
+	},
+	{
+		name:     "adding past the end of an array",
+		doc:      `{"foo": ["bar"]}`,
+		patch:    `[{"op": "add", "path": "/foo/1", "value": "baz"}]`,
+		expected: `{"foo": ["bar", "baz"]}`,
+	},
+	{
+		name:  "removing the end of an array",
+		doc:   `{"foo": ["bar"]}`,
+		patch: `[{"op": "remove", "path": "/foo/-"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "testing the end of an array",
+		doc:   `{"foo": ["bar"]}`,
+		patch: `[{"op": "test", "path": "/foo/-", "value": "bar"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "array index with a leading zero",
+		doc:   `{"foo": ["bar", "baz"]}`,
+		patch: `[{"op": "remove", "path": "/foo/01"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "array index with a sign",
+		doc:   `{"foo": ["bar", "baz"]}`,
+		patch: `[{"op": "remove", "path": "/foo/+1"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "array index out of bounds",
+		doc:   `{"foo": ["bar"]}`,
+		patch: `[{"op": "add", "path": "/foo/2", "value": "baz"}]`,
+		err:   errAny,
+	},
+	{
+		name: "escaped members",
+		doc:  `{"a/b": 1, "m~n": 2}`,
+		patch: `[{"op": "replace", "path": "/a~1b", "value": 3},
+			{"op": "remove", "path": "/m~0n"},
+			{"op": "add", "path": "/~0~1", "value": 4}]`,
+		expected: `{"a/b": 3, "~/": 4}`,
+	},
+	{
+		name:     "adding null keeps the member",
+		doc:      `{"foo": "bar"}`,
+		patch:    `[{"op": "add", "path": "/foo", "value": null}]`,
+		expected: `{"foo": null}`,
+	},
+	{
+		name:     "testing null",
+		doc:      `{"foo": null}`,
+		patch:    `[{"op": "test", "path": "/foo", "value": null}]`,
+		expected: `{"foo": null}`,
+	},
+	{
+		name:  "testing a missing member",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "test", "path": "/baz", "value": null}]`,
+		err:   errAny,
+	},
+	{
+		name:     "testing objects regardless of member order",
+		doc:      `{"foo": {"a": 1, "b": [1, 2]}}`,
+		patch:    `[{"op": "test", "path": "/foo", "value": {"b": [1, 2], "a": 1}}]`,
+		expected: `{"foo": {"a": 1, "b": [1, 2]}}`,
+	},
+	{
+		name:     "replacing the whole document",
+		doc:      `{"foo": "bar"}`,
+		patch:    `[{"op": "replace", "path": "", "value": ["baz"]}]`,
+		expected: `["baz"]`,
+	},
+	{
+		name:  "replacing a missing member",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "replace", "path": "/baz", "value": "qux"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "moving a value into one of its children",
+		doc:   `{"foo": {"bar": 1}}`,
+		patch: `[{"op": "move", "from": "/foo", "path": "/foo/bar/baz"}]`,
+		err:   errAny,
+	},
+	{
+		name:     "moving a value onto itself",
+		doc:      `{"foo": {"bar": 1}}`,
+		patch:    `[{"op": "move", "from": "/foo", "path": "/foo"}]`,
+		expected: `{"foo": {"bar": 1}}`,
+	},
+	{
+		name:     "moving a value to a sibling sharing its prefix",
+		doc:      `{"foo": 1}`,
+		patch:    `[{"op": "move", "from": "/foo", "path": "/foobar"}]`,
+		expected: `{"foobar": 1}`,
+	},
+	{
+		name:     "copying a value into one of its children",
+		doc:      `{"foo": {"bar": 1}}`,
+		patch:    `[{"op": "copy", "from": "/foo", "path": "/foo/baz"}]`,
+		expected: `{"foo": {"bar": 1, "baz": {"bar": 1}}}`,
+	},
+	{
+		name: "copies are not shared",
+		doc:  `{"foo": {"bar": 1}}`,
+		patch: `[{"op": "copy", "from": "/foo", "path": "/baz"},
+			{"op": "replace", "path": "/baz/bar", "value": 2}]`,
+		expected: `{"foo": {"bar": 1}, "baz": {"bar": 2}}`,
+	},
+	{
+		name:  "failed patches are applied as a whole or not at all",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "remove", "path": "/foo"}, {"op": "test", "path": "/foo", "value": "bar"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "unknown operation",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "delete", "path": "/foo"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "missing value",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "missing from",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "copy", "path": "/baz"}]`,
+		err:   errAny,
+	},
+	{
+		name:  "path without a leading slash",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "remove", "path": "foo"}]`,
+		err:   errAny,
+	},
+}
+
+// The examples of RFC 7396 (appendix A).
+var mergePatchTests = []struct {
+	doc      string
+	patch    string
+	expected string
+}{
+	{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+	{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+	{`{"a": "b"}`, `{"a": null}`, `{}`},
+	{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+	{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+	{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+	{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+	{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+	{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+	{`{"a": "b"}`, `["c"]`, `["c"]`},
+	{`{"a": "foo"}`, `null`, `null`},
+	{`{"a": "foo"}`, `"bar"`, `"bar"`},
+	{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+	{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+	{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+}
+
+// errAny stands for any error, when the one returned does not matter.
+var errAny = &struct{ error }{}
+
+func TestJSONPatch(t *testing.T) {
+	for _, test := range jsonPatchTests {
+		patched, err := JSONPatch([]byte(test.doc), []byte(test.patch))
+		switch {
+		case test.err == nil && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case test.err == errAny && err == nil, test.err != nil && test.err != errAny && errors.Cause(err) != test.err:
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+		case test.err == nil:
+			expectSameJSON(t, test.name, patched, test.expected)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, test := range mergePatchTests {
+		name := test.doc + " + " + test.patch
+		patched, err := MergePatch([]byte(test.doc), []byte(test.patch))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+			continue
+		}
+		expectSameJSON(t, name, patched, test.expected)
+	}
+}
+
+func expectSameJSON(t *testing.T, name string, actual []byte, expected string) {
+	var a, e interface{}
+	if err := json.Unmarshal(actual, &a); err != nil {
+		t.Errorf("%s: invalid result %s", name, actual)
+		return
+	}
+	if err := json.Unmarshal([]byte(expected), &e); err != nil {
+		t.Fatalf("%s: invalid expectation %s", name, expected)
+	}
+	if !reflect.DeepEqual(a, e) {
+		t.Errorf("%s: expected %s, got %s", name, expected, actual)
+	}
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	ProblemContentType    = "application/problem+json"
+	ProblemTypeDefault    = "about:blank"
+	ProblemTypeInvalid    = "/problems/validation-error"
+	internalProblemDetail = "An internal error occurred"
+)
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestId string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError points at a single invalid field of a request body, using a
+// JSON pointer (eg. /data/organisation_id), or at an invalid query
+// parameter, with a machine readable code.
+type FieldError struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+func (e FieldError) Error() string {
+	if e.Parameter != "" {
+		return e.Parameter + ": " + e.Detail
+	}
+	return e.Pointer + ": " + e.Detail
+}
+
+// ValidationErrors is returned by validations with every field at fault.
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (errs ValidationErrors) FieldErrors() []FieldError {
+	return errs
+}
+
+type fieldErrorer interface {
+	FieldErrors() []FieldError
+}
+
+func NewProblem(r *http.Request, status int, err error) *Problem {
+	p := &Problem{
+		Type:      ProblemTypeDefault,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Instance:  r.URL.Path,
+		RequestId: RequestId(r),
+	}
+
+	if status >= http.StatusInternalServerError {
+		p.Detail = internalProblemDetail
+		return p
+	}
+
+	if kind := RepoErrorKind(err); kind != nil {
+		p.Detail = kind.Error()
+	} else if err != nil {
+		p.Detail = err.Error()
+	}
+
+	if fe, ok := causeOf(err).(fieldErrorer); ok {
+		p.Type = ProblemTypeInvalid
+		p.Title = "Your request parameters didn't validate"
+		p.Detail = ""
+		p.Errors = fe.FieldErrors()
+	}
+
+	return p
+}
+
+func causeOf(err error) error {
+	for err != nil {
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return err
+}
@@ -1,50 +1,189 @@
 package util
 
 import (
+	"context"
 	"fmt"
+	"time"
 )
 
+// RepoItem is a stored payment. Timestamps are maintained by the repo, in
+// milliseconds since the unix epoch, and are zero when unknown.
 type RepoItem struct {
 	Id           string `db:"id"`
 	Version      int    `db:"version"`
 	Organisation string `db:"organisation"`
+	Status       string `db:"status"`
 	Attributes   string `db:"attributes"`
+	CreatedAt    int64  `db:"created_at"`
+	UpdatedAt    int64  `db:"updated_at"`
+	DeletedAt    int64  `db:"deleted_at"`
+	Audit        RepoAudit
+}
+
+// RepoAudit tells who, and which request, wrote an item. It is only kept in
+// the item history.
+type RepoAudit struct {
+	Actor     string `db:"actor"`
+	RequestId string `db:"request_id"`
+}
+
+const (
+	OperationCreate   = "create"
+	OperationUpdate   = "update"
+	OperationDelete   = "delete"
+	OperationUndelete = "undelete"
+)
+
+// RepoVersion is an immutable snapshot of an item, recorded after each
+// operation on it.
+type RepoVersion struct {
+	Item       RepoItem
+	Operation  string `db:"operation"`
+	RecordedAt int64  `db:"recorded_at"`
+}
+
+// IdempotencyRecord keeps the response sent for a request carrying an
+// Idempotency-Key, so retries of that request get the same response.
+// StatusCode is zero while the first request is still being processed.
+// Headers holds the response headers replayed along with the body.
+// ExpiresAt is in milliseconds, like every other repo timestamp.
+type IdempotencyRecord struct {
+	Key          string            `db:"idempotency_key"`
+	Organisation string            `db:"organisation"`
+	RequestHash  string            `db:"request_hash"`
+	StatusCode   int               `db:"status_code"`
+	ContentType  string            `db:"content_type"`
+	Body         string            `db:"body"`
+	Headers      map[string]string `db:"headers"`
+	ExpiresAt    int64             `db:"expires_at"`
+}
+
+// RepoQuery selects the items returned by List (and counted by Count,
+// regardless of Offset, Limit and Cursor), sorted by Sort and then by
+// id. Empty filters match every item. Amounts are compared as numbers, and
+// Reference is a case insensitive substring. Offset is ignored when
+// paginating with a Cursor. Deleted selects soft-deleted items instead of
+// live ones.
+type RepoQuery struct {
+	Offset       int
+	Limit        int
+	Sort         []RepoSort
+	Cursor       *RepoCursor
+	Deleted      bool
+	Organisation string
+	Status       string
+	Currency     string
+	AmountMin    string
+	AmountMax    string
+	Reference    string
+	// Timestamp ranges, in milliseconds since the unix epoch: after is
+	// inclusive, before is exclusive, and zero means unbounded.
+	CreatedAfter  int64
+	CreatedBefore int64
+	UpdatedAfter  int64
+	UpdatedBefore int64
+}
+
+// RepoSort orders items by a column (eg. status or created_at) or by a member of their
+// attributes (eg. amount). Missing attributes sort as empty strings, or as
+// zero when Numeric.
+type RepoSort struct {
+	Field      string
+	Attribute  bool
+	Numeric    bool
+	Descending bool
+}
+
+// RepoCursor positions a keyset paginated listing next to the item with
+// this id: right after it, or right before it when Backward. Values holds
+// the item values for each field of the query Sort. A cursor without an id
+// stands at the end of the listing, so Backward lists its last items.
+type RepoCursor struct {
+	Id       string
+	Values   []string
+	Backward bool
 }
 
 type RepoInfo struct {
 	Count int `json:"count"`
 }
 
+// DeletedIds is what a repo does with the ids of soft-deleted items, until
+// they are purged.
+type DeletedIds string
+
+const (
+	// DeletedIdsForbid keeps deleted ids as tombstones: fetching or creating
+	// them fails with ErrGone.
+	DeletedIdsForbid DeletedIds = "forbid"
+	// DeletedIdsReuse lets Create replace a deleted item, whose versions go
+	// on from the deleted one. Fetching a deleted id fails with ErrNotFound.
+	DeletedIdsReuse DeletedIds = "reuse"
+)
+
 type RepoConfig struct {
 	Driver     string
 	Uri        string
 	Migrations string
 	Schema     string
+	DeletedIds DeletedIds
 }
 
 type Repo interface {
 	Init() error
 	Description() string
-	Info() (RepoInfo, error)
-	Check() error
+	Info(ctx context.Context) (RepoInfo, error)
+	Check(ctx context.Context) error
 	Close() error
-	List(offset int, limit int) ([]*RepoItem, error)
-	Create(item *RepoItem) (*RepoItem, error)
-	Update(item *RepoItem) (*RepoItem, error)
-	Fetch(item *RepoItem) (*RepoItem, error)
-	Delete(item *RepoItem) error
-	DeleteAll() error
-	IsConflict(err error) bool
-	IsNotFound(err error) bool
+	List(ctx context.Context, query RepoQuery) ([]*RepoItem, error)
+	Count(ctx context.Context, query RepoQuery) (int, error)
+	Create(ctx context.Context, item *RepoItem) (*RepoItem, error)
+	CreateMany(ctx context.Context, items []*RepoItem, atomic bool) ([]error, error)
+	Update(ctx context.Context, item *RepoItem) (*RepoItem, error)
+	Fetch(ctx context.Context, item *RepoItem) (*RepoItem, error)
+	Delete(ctx context.Context, item *RepoItem) error
+	History(ctx context.Context, id string) ([]*RepoVersion, error)
+	Undelete(ctx context.Context, item *RepoItem) (*RepoItem, error)
+	Purge(ctx context.Context, deletedBefore int64) (int, error)
+	DeleteAll(ctx context.Context) error
+	WithTx(ctx context.Context, fn func(tx Repo) error) error
+	CreateIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error
+	FetchIdempotencyRecord(ctx context.Context, key string, organisation string) (*IdempotencyRecord, error)
+	UpdateIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error
+	DeleteIdempotencyRecord(ctx context.Context, key string, organisation string) error
+	PurgeIdempotencyRecords(ctx context.Context, expiredBefore int64) (int, error)
+}
+
+// NowMillis returns the current time in milliseconds since the unix epoch,
+// as kept in every repo timestamp.
+func NowMillis() int64 {
+	return Millis(time.Now())
+}
+
+func Millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
 }
 
 func NewRepo(config RepoConfig) (Repo, error) {
 	var db Repo
+	switch config.DeletedIds {
+	case "":
+		config.DeletedIds = DeletedIdsForbid
+	case DeletedIdsForbid, DeletedIdsReuse:
+	default:
+		return db, fmt.Errorf("deleted ids policy not supported: %v", config.DeletedIds)
+	}
 	switch config.Driver {
 	case "sqlite3":
 		return NewSqlite3Repo(config)
 	case "postgres":
 		return NewPostgresRepo(config)
+	case "mysql":
+		return NewMysqlRepo(config)
+	case "memory":
+		return NewMemoryRepo(config)
+	case "bolt":
+		return NewBoltRepo(config)
 	default:
 		return db, fmt.Errorf("repo driver not supported: %v", config.Driver)
 	}
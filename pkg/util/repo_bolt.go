@@ -0,0 +1,743 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"sort"
+	"time"
+)
+
+// BoltRepo keeps items in a single bbolt file, a durable store needing
+// neither cgo nor a database server. Items are indexed by organisation,
+// creation time and deletion time, in buckets of their own. Writes take
+// turns, while reads see a consistent snapshot.
+type BoltRepo struct {
+	db         *bolt.DB
+	tx         *bolt.Tx
+	path       string
+	buckets    boltBuckets
+	deletedIds DeletedIds
+}
+
+// boltBuckets names the buckets of a repo: items by id, their indexes,
+// their versions, and the idempotency records.
+type boltBuckets struct {
+	items          []byte
+	byOrganisation []byte
+	byCreated      []byte
+	byDeleted      []byte
+	versions       []byte
+	idempotency    []byte
+}
+
+func (b boltBuckets) all() [][]byte {
+	return [][]byte{b.items, b.byOrganisation, b.byCreated, b.byDeleted, b.versions, b.idempotency}
+}
+
+type boltItem struct {
+	RepoItem
+	Deleted bool
+}
+
+func NewBoltRepo(config RepoConfig) (Repo, error) {
+	if config.Uri == "" {
+		return nil, fmt.Errorf("bolt repos need a file, eg. --repo-uri=/path/file.db")
+	}
+	db, err := bolt.Open(config.Uri, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to open the database")
+	}
+	schema := config.Schema
+	return &BoltRepo{
+		db:   db,
+		path: config.Uri,
+		buckets: boltBuckets{
+			items:          []byte(schema),
+			byOrganisation: []byte(schema + "_by_organisation"),
+			byCreated:      []byte(schema + "_by_created"),
+			byDeleted:      []byte(schema + "_by_deleted"),
+			versions:       []byte(schema + "_versions"),
+			idempotency:    []byte(schema + "_idempotency"),
+		},
+		deletedIds: config.DeletedIds,
+	}, nil
+}
+
+// boltError classifies an error, wrapping it into a RepoError when bbolt
+// could not reach the file.
+func boltError(op string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case err == bolt.ErrDatabaseNotOpen, err == bolt.ErrTimeout, err == bolt.ErrDatabaseReadOnly:
+		return NewRepoError(ErrUnavailable, op, err)
+	case RepoErrorKind(err) != nil:
+		return err
+	default:
+		return errors.Wrap(err, op)
+	}
+}
+
+// view runs fn in a read-only transaction, or in the transaction the repo
+// is bound to.
+func (repo *BoltRepo) view(op string, fn func(tx *bolt.Tx) error) error {
+	if repo.tx != nil {
+		return boltError(op, fn(repo.tx))
+	}
+	return boltError(op, repo.db.View(fn))
+}
+
+// update runs fn in a transaction of its own, rolled back if fn fails, or
+// as part of the transaction the repo is bound to.
+func (repo *BoltRepo) update(op string, fn func(tx *bolt.Tx) error) error {
+	if repo.tx != nil {
+		return boltError(op, fn(repo.tx))
+	}
+	return boltError(op, repo.db.Update(fn))
+}
+
+func (repo *BoltRepo) Init() error {
+	if len(repo.buckets.items) == 0 {
+		return fmt.Errorf("no schema defined")
+	}
+	return repo.update("init", func(tx *bolt.Tx) error {
+		for _, name := range repo.buckets.all() {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (repo *BoltRepo) Description() string {
+	if repo.tx != nil {
+		return "transaction"
+	}
+	return fmt.Sprintf("bolt (%s)", repo.path)
+}
+
+func (repo *BoltRepo) Close() error {
+	if repo.tx != nil {
+		return fmt.Errorf("a transaction cannot close its repo")
+	}
+	return repo.db.Close()
+}
+
+func (repo *BoltRepo) Check(ctx context.Context) error {
+	return repo.view("check", func(tx *bolt.Tx) error { return nil })
+}
+
+// Info counts the live items, as all the items but the deleted ones.
+func (repo *BoltRepo) Info(ctx context.Context) (RepoInfo, error) {
+	var info RepoInfo
+	err := repo.view("info", func(tx *bolt.Tx) error {
+		info.Count = tx.Bucket(repo.buckets.items).Stats().KeyN - tx.Bucket(repo.buckets.byDeleted).Stats().KeyN
+		return nil
+	})
+	return info, err
+}
+
+// WithTx runs fn with a repo bound to a new writable transaction, so
+// transactions take turns, committed when fn succeeds, and rolled back
+// otherwise (or when ctx is done first).
+func (repo *BoltRepo) WithTx(ctx context.Context, fn func(tx Repo) error) error {
+	if repo.tx != nil {
+		return fn(repo)
+	}
+	tx, err := repo.db.Begin(true)
+	if err != nil {
+		return boltError("begin", err)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	txRepo := *repo
+	txRepo.tx = tx
+	err = fn(&txRepo)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return boltError("commit", err)
+	}
+	committed = true
+	return nil
+}
+
+// candidates returns the items a query may select, narrowed down with the
+// organisation or creation time indexes when the query filters on them.
+func (repo *BoltRepo) candidates(tx *bolt.Tx, query RepoQuery, fn func(item *boltItem) error) error {
+	items := tx.Bucket(repo.buckets.items)
+	// fromIndex visits the items of the index entries from first to last
+	// (excluded, or unbounded when nil)
+	fromIndex := func(bucket []byte, first []byte, last []byte) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, id := c.Seek(first); k != nil && (last == nil || bytes.Compare(k, last) < 0); k, id = c.Next() {
+			item, err := decodeBoltItem(items.Get(id))
+			if err != nil {
+				return err
+			}
+			if err = fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch {
+	case query.Organisation != "":
+		prefix := organisationKey(query.Organisation, "")
+		return fromIndex(repo.buckets.byOrganisation, prefix, prefixEnd(prefix))
+	case query.CreatedAfter != 0 || query.CreatedBefore != 0:
+		var last []byte
+		if query.CreatedBefore != 0 {
+			last = timeKey(query.CreatedBefore, "")
+		}
+		return fromIndex(repo.buckets.byCreated, timeKey(query.CreatedAfter, ""), last)
+	default:
+		return items.ForEach(func(k, v []byte) error {
+			item, err := decodeBoltItem(v)
+			if err != nil {
+				return err
+			}
+			return fn(item)
+		})
+	}
+}
+
+func (repo *BoltRepo) List(ctx context.Context, query RepoQuery) ([]*RepoItem, error) {
+	items := []*RepoItem{}
+	if query.Cursor != nil && query.Cursor.Id != "" && len(query.Cursor.Values) != len(query.Sort) {
+		return items, NewRepoError(ErrInvalid, "list", fmt.Errorf("cursor does not match the sort order"))
+	}
+
+	var found []*RepoItem
+	err := repo.view("list", func(tx *bolt.Tx) error {
+		return repo.candidates(tx, query, func(item *boltItem) error {
+			if matches(&item.RepoItem, item.Deleted, query) {
+				found = append(found, &item.RepoItem)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return items, err
+	}
+	return sortPage(found, query), nil
+}
+
+func (repo *BoltRepo) Count(ctx context.Context, query RepoQuery) (int, error) {
+	count := 0
+	err := repo.view("count", func(tx *bolt.Tx) error {
+		return repo.candidates(tx, query, func(item *boltItem) error {
+			if matches(&item.RepoItem, item.Deleted, query) {
+				count++
+			}
+			return nil
+		})
+	})
+	return count, err
+}
+
+func (repo *BoltRepo) Fetch(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	var found *boltItem
+	err := repo.view("fetch", func(tx *bolt.Tx) error {
+		var err error
+		found, err = repo.get(tx, item.Id)
+		return err
+	})
+	switch {
+	case err != nil:
+		return &RepoItem{}, err
+	case found == nil:
+		return &RepoItem{}, NewRepoError(ErrNotFound, "fetch", nil)
+	case found.Deleted:
+		return &RepoItem{}, repo.deletedError("fetch")
+	}
+	return &found.RepoItem, nil
+}
+
+// deletedError is the error returned when reaching a soft-deleted item,
+// depending on the deleted ids policy.
+func (repo *BoltRepo) deletedError(op string) error {
+	if repo.deletedIds == DeletedIdsReuse {
+		return NewRepoError(ErrNotFound, op, nil)
+	}
+	return NewRepoError(ErrGone, op, nil)
+}
+
+// nextVersion is the version an item is created at, unless its id is
+// taken by a live item, or by a deleted one and deleted ids are forbidden.
+func (repo *BoltRepo) nextVersion(found *boltItem, op string) (int, error) {
+	switch {
+	case found == nil:
+		return 0, nil
+	case !found.Deleted:
+		return 0, NewRepoError(ErrDuplicateId, op, nil)
+	case repo.deletedIds != DeletedIdsReuse:
+		return 0, NewRepoError(ErrGone, op, nil)
+	default:
+		return found.Version + 1, nil
+	}
+}
+
+func (repo *BoltRepo) create(tx *bolt.Tx, found *boltItem, item *RepoItem, version int, now int64) error {
+	stored := &boltItem{RepoItem: RepoItem{
+		Id:           item.Id,
+		Version:      version,
+		Organisation: item.Organisation,
+		Status:       item.Status,
+		Attributes:   item.Attributes,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}}
+	// a deleted item being replaced takes its history along, as the new
+	// one may belong to another organisation
+	if found != nil {
+		if err := repo.removeVersions(tx, item.Id); err != nil {
+			return err
+		}
+	}
+	if err := repo.put(tx, found, stored); err != nil {
+		return err
+	}
+	if err := repo.recordVersion(tx, OperationCreate, stored, item.Audit); err != nil {
+		return err
+	}
+	item.Version = version
+	item.CreatedAt, item.UpdatedAt = now, now
+	return nil
+}
+
+func (repo *BoltRepo) Create(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	err := repo.update("create", func(tx *bolt.Tx) error {
+		found, err := repo.get(tx, item.Id)
+		if err != nil {
+			return err
+		}
+		version, err := repo.nextVersion(found, "create")
+		if err != nil {
+			return err
+		}
+		return repo.create(tx, found, item, version, NowMillis())
+	})
+	return item, err
+}
+
+func (repo *BoltRepo) CreateMany(ctx context.Context, items []*RepoItem, atomic bool) ([]error, error) {
+	errs := make([]error, len(items))
+	err := repo.update("create many", func(tx *bolt.Tx) error {
+		found := make([]*boltItem, len(items))
+		versions := make([]int, len(items))
+		seen := make(map[string]bool)
+		failed := false
+		for i, item := range items {
+			if seen[item.Id] {
+				errs[i] = NewRepoError(ErrDuplicateId, "create many", nil)
+			} else {
+				var err error
+				found[i], err = repo.get(tx, item.Id)
+				if err != nil {
+					return err
+				}
+				versions[i], errs[i] = repo.nextVersion(found[i], "create many")
+			}
+			seen[item.Id] = true
+			failed = failed || errs[i] != nil
+		}
+
+		if atomic && failed {
+			return nil
+		}
+		now := NowMillis()
+		for i, item := range items {
+			if errs[i] != nil {
+				continue
+			}
+			if err := repo.create(tx, found[i], item, versions[i], now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errs, err
+}
+
+// Update replaces the attributes and status of an item, as long as it was
+// not changed since it was fetched at item.Version, failing with
+// ErrConflict otherwise.
+func (repo *BoltRepo) Update(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	err := repo.update("update", func(tx *bolt.Tx) error {
+		found, err := repo.get(tx, item.Id)
+		if err != nil {
+			return err
+		}
+		if found == nil || found.Deleted || found.Version != item.Version {
+			return NewRepoError(ErrConflict, "update", nil)
+		}
+		stored := *found
+		stored.Attributes, stored.Status = item.Attributes, item.Status
+		stored.Version++
+		stored.UpdatedAt = NowMillis()
+		if err = repo.put(tx, found, &stored); err != nil {
+			return err
+		}
+		if err = repo.recordVersion(tx, OperationUpdate, &stored, item.Audit); err != nil {
+			return err
+		}
+
+		item.Version = stored.Version
+		item.UpdatedAt = stored.UpdatedAt
+		return nil
+	})
+	return item, err
+}
+
+// Delete soft-deletes an item, as a new version.
+func (repo *BoltRepo) Delete(ctx context.Context, item *RepoItem) error {
+	return repo.update("delete", func(tx *bolt.Tx) error {
+		found, err := repo.get(tx, item.Id)
+		if err != nil {
+			return err
+		}
+		if found == nil || found.Deleted || found.Version != item.Version {
+			return NewRepoError(ErrConflict, "delete", nil)
+		}
+		stored := *found
+		stored.Deleted = true
+		stored.Version++
+		stored.DeletedAt = NowMillis()
+		if err = repo.put(tx, found, &stored); err != nil {
+			return err
+		}
+		return repo.recordVersion(tx, OperationDelete, &stored, item.Audit)
+	})
+}
+
+// Undelete restores a soft-deleted item, as a new version.
+func (repo *BoltRepo) Undelete(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	var restored boltItem
+	err := repo.update("undelete", func(tx *bolt.Tx) error {
+		found, err := repo.get(tx, item.Id)
+		if err != nil {
+			return err
+		}
+		if found == nil || !found.Deleted {
+			return NewRepoError(ErrNotFound, "undelete", nil)
+		}
+		restored = *found
+		restored.Deleted = false
+		restored.Version++
+		restored.DeletedAt = 0
+		restored.UpdatedAt = NowMillis()
+		if err = repo.put(tx, found, &restored); err != nil {
+			return err
+		}
+		return repo.recordVersion(tx, OperationUndelete, &restored, item.Audit)
+	})
+	if err != nil {
+		return item, err
+	}
+	return &restored.RepoItem, nil
+}
+
+// Purge removes for good the items soft-deleted at or before a time, returning
+// how many were removed, along with their history.
+func (repo *BoltRepo) Purge(ctx context.Context, deletedBefore int64) (int, error) {
+	purged := 0
+	err := repo.update("purge", func(tx *bolt.Tx) error {
+		var ids []string
+		last := timeKey(deletedBefore+1, "")
+		c := tx.Bucket(repo.buckets.byDeleted).Cursor()
+		for k, id := c.First(); k != nil && bytes.Compare(k, last) < 0; k, id = c.Next() {
+			ids = append(ids, string(id))
+		}
+		for _, id := range ids {
+			found, err := repo.get(tx, id)
+			if err != nil {
+				return err
+			}
+			if err = repo.put(tx, found, nil); err != nil {
+				return err
+			}
+			if err = repo.removeVersions(tx, id); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (repo *BoltRepo) DeleteAll(ctx context.Context) error {
+	return repo.update("delete all", func(tx *bolt.Tx) error {
+		for _, name := range repo.buckets.all() {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// recordVersion snapshots the stored item, as left by an operation.
+// Versions are keyed by item id and then by a sequence, so the history of
+// an item is a range of keys, in the order it was recorded.
+func (repo *BoltRepo) recordVersion(tx *bolt.Tx, operation string, stored *boltItem, audit RepoAudit) error {
+	v := &RepoVersion{Item: stored.RepoItem, Operation: operation, RecordedAt: NowMillis()}
+	v.Item.Audit = audit
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	versions := tx.Bucket(repo.buckets.versions)
+	seq, err := versions.NextSequence()
+	if err != nil {
+		return err
+	}
+	return versions.Put(versionKey(stored.Id, seq), value)
+}
+
+// removeVersions removes the history of an item.
+func (repo *BoltRepo) removeVersions(tx *bolt.Tx, id string) error {
+	versions := tx.Bucket(repo.buckets.versions)
+	prefix := []byte(id + "\x00")
+	var keys [][]byte
+	c := versions.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := versions.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repo *BoltRepo) History(ctx context.Context, id string) ([]*RepoVersion, error) {
+	versions := []*RepoVersion{}
+	err := repo.view("history", func(tx *bolt.Tx) error {
+		prefix := []byte(id + "\x00")
+		c := tx.Bucket(repo.buckets.versions).Cursor()
+		for k, value := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, value = c.Next() {
+			v := &RepoVersion{}
+			if err := json.Unmarshal(value, v); err != nil {
+				return err
+			}
+			versions = append(versions, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return versions, err
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Item.Version < versions[j].Item.Version
+	})
+
+	if len(versions) == 0 {
+		return versions, NewRepoError(ErrNotFound, "history", nil)
+	}
+	return versions, nil
+}
+
+func (repo *BoltRepo) CreateIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	return repo.update("create idempotency record", func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(repo.buckets.idempotency)
+		key := organisationKey(record.Organisation, record.Key)
+		if bucket.Get(key) != nil {
+			return NewRepoError(ErrDuplicateId, "create idempotency record", nil)
+		}
+		return putJSON(bucket, key, record)
+	})
+}
+
+func (repo *BoltRepo) FetchIdempotencyRecord(ctx context.Context, key string, organisation string) (*IdempotencyRecord, error) {
+	found := &IdempotencyRecord{}
+	err := repo.view("fetch idempotency record", func(tx *bolt.Tx) error {
+		value := tx.Bucket(repo.buckets.idempotency).Get(organisationKey(organisation, key))
+		if value == nil {
+			return NewRepoError(ErrNotFound, "fetch idempotency record", nil)
+		}
+		return json.Unmarshal(value, found)
+	})
+	if err != nil {
+		return &IdempotencyRecord{}, err
+	}
+	return found, nil
+}
+
+func (repo *BoltRepo) UpdateIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	return repo.update("update idempotency record", func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(repo.buckets.idempotency)
+		key := organisationKey(record.Organisation, record.Key)
+		value := bucket.Get(key)
+		if value == nil {
+			return NewRepoError(ErrNotFound, "update idempotency record", nil)
+		}
+		updated := &IdempotencyRecord{}
+		if err := json.Unmarshal(value, updated); err != nil {
+			return err
+		}
+		updated.StatusCode, updated.ContentType, updated.Body = record.StatusCode, record.ContentType, record.Body
+		updated.Headers = record.Headers
+		return putJSON(bucket, key, updated)
+	})
+}
+
+func (repo *BoltRepo) DeleteIdempotencyRecord(ctx context.Context, key string, organisation string) error {
+	return repo.update("delete idempotency record", func(tx *bolt.Tx) error {
+		return tx.Bucket(repo.buckets.idempotency).Delete(organisationKey(organisation, key))
+	})
+}
+
+func (repo *BoltRepo) PurgeIdempotencyRecords(ctx context.Context, expiredBefore int64) (int, error) {
+	purged := 0
+	err := repo.update("purge idempotency records", func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(repo.buckets.idempotency)
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			record := &IdempotencyRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+			if record.ExpiresAt <= expiredBefore {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (repo *BoltRepo) get(tx *bolt.Tx, id string) (*boltItem, error) {
+	value := tx.Bucket(repo.buckets.items).Get([]byte(id))
+	if value == nil {
+		return nil, nil
+	}
+	return decodeBoltItem(value)
+}
+
+// put replaces an item, found as old (nil when new), along with its index
+// entries. A nil item removes the old one.
+func (repo *BoltRepo) put(tx *bolt.Tx, old *boltItem, item *boltItem) error {
+	items := tx.Bucket(repo.buckets.items)
+	byOrganisation := tx.Bucket(repo.buckets.byOrganisation)
+	byCreated := tx.Bucket(repo.buckets.byCreated)
+	byDeleted := tx.Bucket(repo.buckets.byDeleted)
+
+	if old != nil {
+		deletes := []struct {
+			bucket *bolt.Bucket
+			key    []byte
+		}{
+			{byOrganisation, organisationKey(old.Organisation, old.Id)},
+			{byCreated, timeKey(old.CreatedAt, old.Id)},
+			{byDeleted, timeKey(old.DeletedAt, old.Id)},
+		}
+		for _, d := range deletes {
+			if err := d.bucket.Delete(d.key); err != nil {
+				return err
+			}
+		}
+	}
+	if item == nil {
+		return items.Delete([]byte(old.Id))
+	}
+
+	id := []byte(item.Id)
+	stored := *item
+	stored.Audit = RepoAudit{}
+	if err := putJSON(items, id, &stored); err != nil {
+		return err
+	}
+	if err := byOrganisation.Put(organisationKey(item.Organisation, item.Id), id); err != nil {
+		return err
+	}
+	if err := byCreated.Put(timeKey(item.CreatedAt, item.Id), id); err != nil {
+		return err
+	}
+	if item.Deleted {
+		return byDeleted.Put(timeKey(item.DeletedAt, item.Id), id)
+	}
+	return nil
+}
+
+func decodeBoltItem(value []byte) (*boltItem, error) {
+	item := &boltItem{}
+	err := json.Unmarshal(value, item)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing stored item")
+	}
+	return item, nil
+}
+
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, encoded)
+}
+
+// Index keys end with the id of their item, after a value they are sorted
+// by: a string ended by a zero byte, or a big endian timestamp.
+
+func organisationKey(organisation string, id string) []byte {
+	return []byte(organisation + "\x00" + id)
+}
+
+func timeKey(millis int64, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(millis))
+	return append(key, id...)
+}
+
+func versionKey(id string, seq uint64) []byte {
+	key := []byte(id + "\x00")
+	seqBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(seqBytes, seq)
+	return append(key, seqBytes...)
+}
+
+// prefixEnd is the first key after all the keys starting with prefix.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package util
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// Kinds of repo errors. Backends translate their driver specific errors
+// into one of these, so callers never need to look at error messages.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("version conflict")
+	ErrDuplicateId = errors.New("duplicate id")
+	ErrUnavailable = errors.New("repo unavailable")
+	ErrInvalid     = errors.New("invalid input")
+	ErrGone        = errors.New("deleted")
+)
+
+type RepoError struct {
+	Kind error
+	Op   string
+	Err  error
+}
+
+func (e *RepoError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %v", e.Op, e.Kind)
+	}
+	return fmt.Sprintf("%s: %v: %v", e.Op, e.Kind, e.Err)
+}
+
+func (e *RepoError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RepoError) Is(target error) bool {
+	return e.Kind == target
+}
+
+func NewRepoError(kind error, op string, err error) error {
+	return &RepoError{Kind: kind, Op: op, Err: err}
+}
+
+type causer interface {
+	Cause() error
+}
+
+// RepoErrorKind walks the chain of wrapped errors, through both Cause and
+// Unwrap, and returns the kind of the first repo error found, or nil if err
+// did not come from a repo.
+func RepoErrorKind(err error) error {
+	for err != nil {
+		switch e := err.(type) {
+		case *RepoError:
+			return e.Kind
+		case causer:
+			err = e.Cause()
+		default:
+			if isRepoErrorKind(err) {
+				return err
+			}
+			err = errors.Unwrap(err)
+		}
+	}
+	return nil
+}
+
+func isRepoErrorKind(err error) bool {
+	switch err {
+	case ErrNotFound, ErrConflict, ErrDuplicateId, ErrUnavailable, ErrInvalid, ErrGone:
+		return true
+	default:
+		return false
+	}
+}
+
+func IsNotFound(err error) bool {
+	return RepoErrorKind(err) == ErrNotFound
+}
+
+func IsConflict(err error) bool {
+	return RepoErrorKind(err) == ErrConflict
+}
+
+func IsDuplicateId(err error) bool {
+	return RepoErrorKind(err) == ErrDuplicateId
+}
+
+func IsUnavailable(err error) bool {
+	return RepoErrorKind(err) == ErrUnavailable
+}
+
+func IsInvalid(err error) bool {
+	return RepoErrorKind(err) == ErrInvalid
+}
+
+// ErrorTranslator maps a driver specific error into one of the repo error
+// kinds, returning nil when the error is not recognised.
+type ErrorTranslator func(err error) error
+
+func translateCommonError(err error) error {
+	if err == driver.ErrBadConn {
+		return ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"testing"
+)
+
+var repoErrorKindTests = []struct {
+	name string
+	err  error
+	kind error
+}{
+	{"nil", nil, nil},
+	{"other error", errors.New("boom"), nil},
+	{"kind", ErrGone, ErrGone},
+	{"repo error", NewRepoError(ErrNotFound, "get", nil), ErrNotFound},
+	{"wrapped with Wrap", errors.Wrap(NewRepoError(ErrConflict, "update", nil), "patching"), ErrConflict},
+	{"wrapped with %w", fmt.Errorf("patching: %w", NewRepoError(ErrConflict, "update", nil)), ErrConflict},
+	{"kind wrapped with %w", fmt.Errorf("creating: %w", ErrDuplicateId), ErrDuplicateId},
+	{"%w over Wrap", fmt.Errorf("batch: %w", errors.Wrap(ErrUnavailable, "connecting")), ErrUnavailable},
+	{"Wrap over %w", errors.Wrap(fmt.Errorf("listing: %w", ErrInvalid), "query"), ErrInvalid},
+	{"%v does not wrap", fmt.Errorf("patching: %v", ErrConflict), nil},
+}
+
+func TestRepoErrorKind(t *testing.T) {
+	for _, test := range repoErrorKindTests {
+		if kind := RepoErrorKind(test.err); kind != test.kind {
+			t.Errorf("%s: expected %v, got %v", test.name, test.kind, kind)
+		}
+	}
+}
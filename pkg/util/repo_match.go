@@ -0,0 +1,174 @@
+package util
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Repos without SQL filter and sort items themselves, with these helpers.
+
+// matches tells whether an item is selected by the filters of a query, as
+// the WHERE clause of the SQL repos would.
+func matches(item *RepoItem, deleted bool, query RepoQuery) bool {
+	if deleted != query.Deleted {
+		return false
+	}
+	if query.Organisation != "" && item.Organisation != query.Organisation {
+		return false
+	}
+	if query.Status != "" && item.Status != query.Status {
+		return false
+	}
+	if query.Currency != "" && attribute(item, "currency") != query.Currency {
+		return false
+	}
+	if query.AmountMin != "" || query.AmountMax != "" {
+		amount := attribute(item, "amount")
+		if amount == "" {
+			return false
+		}
+		if query.AmountMin != "" && numberOf(amount).Cmp(numberOf(query.AmountMin)) < 0 {
+			return false
+		}
+		if query.AmountMax != "" && numberOf(amount).Cmp(numberOf(query.AmountMax)) > 0 {
+			return false
+		}
+	}
+	if query.CreatedAfter != 0 && item.CreatedAt < query.CreatedAfter ||
+		query.CreatedBefore != 0 && item.CreatedAt >= query.CreatedBefore ||
+		query.UpdatedAfter != 0 && item.UpdatedAt < query.UpdatedAfter ||
+		query.UpdatedBefore != 0 && item.UpdatedAt >= query.UpdatedBefore {
+		return false
+	}
+	if query.Reference != "" {
+		reference := attribute(item, "reference")
+		if reference == "" || !strings.Contains(strings.ToLower(reference), strings.ToLower(query.Reference)) {
+			return false
+		}
+	}
+	return true
+}
+
+// attribute is a top level member of the item attributes as text, or an
+// empty string when missing.
+func attribute(item *RepoItem, key string) string {
+	return jsonExtract(item.Attributes, "$."+key)
+}
+
+// numberOf parses a number as SQL casts text to NUMERIC, with zero for
+// anything else.
+func numberOf(s string) *big.Rat {
+	n, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return new(big.Rat)
+	}
+	return n
+}
+
+// sortPage sorts the items matching a query, and returns the page of them
+// the query selects, as the ORDER BY and LIMIT clauses of the SQL repos
+// would.
+func sortPage(found []*RepoItem, query RepoQuery) []*RepoItem {
+	keys := sortKeys(query)
+	backward := query.Cursor != nil && query.Cursor.Backward
+	var cursor []string
+	if query.Cursor != nil && query.Cursor.Id != "" {
+		cursor = append(append([]string{}, query.Cursor.Values...), query.Cursor.Id)
+	}
+
+	type sortable struct {
+		item   *RepoItem
+		values []string
+	}
+	sorted := make([]sortable, len(found))
+	for i, item := range found {
+		sorted[i] = sortable{item, sortValues(item, keys)}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		c := compareSortValues(sorted[i].values, sorted[j].values, keys)
+		if backward {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	items := []*RepoItem{}
+	for _, s := range sorted {
+		if cursor != nil {
+			c := compareSortValues(s.values, cursor, keys)
+			if backward && c >= 0 || !backward && c <= 0 {
+				continue
+			}
+		}
+		items = append(items, s.item)
+	}
+
+	if query.Offset > len(items) {
+		query.Offset = len(items)
+	}
+	items = items[query.Offset:]
+	if query.Limit >= 0 && query.Limit < len(items) {
+		items = items[:query.Limit]
+	}
+
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	return items
+}
+
+func sortValues(item *RepoItem, keys []RepoSort) []string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = sortValue(item, key)
+	}
+	return values
+}
+
+func sortValue(item *RepoItem, key RepoSort) string {
+	if key.Attribute {
+		value := attribute(item, key.Field)
+		if value == "" && key.Numeric {
+			return "0"
+		}
+		return value
+	}
+	switch key.Field {
+	case "id":
+		return item.Id
+	case "organisation":
+		return item.Organisation
+	case "status":
+		return item.Status
+	case "created_at":
+		return strconv.FormatInt(item.CreatedAt, 10)
+	case "updated_at":
+		return strconv.FormatInt(item.UpdatedAt, 10)
+	default:
+		return ""
+	}
+}
+
+// compareSortValues compares the sort values of two items, in the order
+// of the sort keys.
+func compareSortValues(a []string, b []string, keys []RepoSort) int {
+	for i, key := range keys {
+		var c int
+		if key.Numeric {
+			c = numberOf(a[i]).Cmp(numberOf(b[i]))
+		} else {
+			c = strings.Compare(a[i], b[i])
+		}
+		if key.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,502 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryRepo keeps items in plain Go maps, behaving like the SQL repos
+// without needing cgo, a database or migrations. Everything is lost on
+// restart.
+type MemoryRepo struct {
+	mu         *sync.RWMutex
+	data       *memoryData
+	deletedIds DeletedIds
+	tx         *memoryTx
+}
+
+type memoryItem struct {
+	RepoItem
+	deleted bool
+}
+
+type idempotencyKey struct {
+	key          string
+	organisation string
+}
+
+type memoryData struct {
+	items       map[string]*memoryItem
+	versions    map[string][]*RepoVersion
+	idempotency map[idempotencyKey]*IdempotencyRecord
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		items:       make(map[string]*memoryItem),
+		versions:    make(map[string][]*RepoVersion),
+		idempotency: make(map[idempotencyKey]*IdempotencyRecord),
+	}
+}
+
+// memoryTx records how to undo each write of a transaction. Stored values
+// are never modified in place, but replaced, so undoing a write only
+// needs to put back what it replaced.
+type memoryTx struct {
+	undo []func()
+}
+
+func (tx *memoryTx) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+}
+
+func (tx *memoryTx) putItem(d *memoryData, item *memoryItem) {
+	old, ok := d.items[item.Id]
+	tx.undo = append(tx.undo, func() {
+		if ok {
+			d.items[item.Id] = old
+		} else {
+			delete(d.items, item.Id)
+		}
+	})
+	d.items[item.Id] = item
+}
+
+func (tx *memoryTx) removeItem(d *memoryData, id string) {
+	old := d.items[id]
+	tx.undo = append(tx.undo, func() { d.items[id] = old })
+	delete(d.items, id)
+}
+
+func (tx *memoryTx) addVersion(d *memoryData, v *RepoVersion) {
+	old := d.versions[v.Item.Id]
+	tx.undo = append(tx.undo, func() { d.versions[v.Item.Id] = old })
+	d.versions[v.Item.Id] = append(old[:len(old):len(old)], v)
+}
+
+func (tx *memoryTx) removeVersions(d *memoryData, id string) {
+	old, ok := d.versions[id]
+	if !ok {
+		return
+	}
+	tx.undo = append(tx.undo, func() { d.versions[id] = old })
+	delete(d.versions, id)
+}
+
+func (tx *memoryTx) putIdempotencyRecord(d *memoryData, record *IdempotencyRecord) {
+	k := idempotencyKey{record.Key, record.Organisation}
+	old, ok := d.idempotency[k]
+	tx.undo = append(tx.undo, func() {
+		if ok {
+			d.idempotency[k] = old
+		} else {
+			delete(d.idempotency, k)
+		}
+	})
+	d.idempotency[k] = record
+}
+
+func (tx *memoryTx) removeIdempotencyRecord(d *memoryData, k idempotencyKey) {
+	old, ok := d.idempotency[k]
+	if !ok {
+		return
+	}
+	tx.undo = append(tx.undo, func() { d.idempotency[k] = old })
+	delete(d.idempotency, k)
+}
+
+func (tx *memoryTx) clear(d *memoryData) {
+	old := *d
+	tx.undo = append(tx.undo, func() { *d = old })
+	*d = *newMemoryData()
+}
+
+func NewMemoryRepo(config RepoConfig) (Repo, error) {
+	return &MemoryRepo{
+		mu:         &sync.RWMutex{},
+		data:       newMemoryData(),
+		deletedIds: config.DeletedIds,
+	}, nil
+}
+
+// read runs fn under the read lock, unless the repo is bound to a
+// transaction, which already holds the write lock.
+func (repo *MemoryRepo) read(fn func(d *memoryData)) {
+	if repo.tx == nil {
+		repo.mu.RLock()
+		defer repo.mu.RUnlock()
+	}
+	fn(repo.data)
+}
+
+// write runs fn as a transaction of its own, undone if fn fails, or as
+// part of the transaction the repo is bound to.
+func (repo *MemoryRepo) write(fn func(d *memoryData, tx *memoryTx) error) error {
+	if repo.tx != nil {
+		return fn(repo.data, repo.tx)
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	tx := &memoryTx{}
+	err := fn(repo.data, tx)
+	if err != nil {
+		tx.rollback()
+	}
+	return err
+}
+
+func (repo *MemoryRepo) Init() error {
+	return nil
+}
+
+func (repo *MemoryRepo) Description() string {
+	return "memory"
+}
+
+func (repo *MemoryRepo) Close() error {
+	return nil
+}
+
+func (repo *MemoryRepo) Check(ctx context.Context) error {
+	return nil
+}
+
+func (repo *MemoryRepo) Info(ctx context.Context) (RepoInfo, error) {
+	var info RepoInfo
+	repo.read(func(d *memoryData) {
+		for _, item := range d.items {
+			if !item.deleted {
+				info.Count++
+			}
+		}
+	})
+	return info, nil
+}
+
+// WithTx runs fn holding the write lock, so transactions take turns, and
+// undoes its writes when it fails (or when ctx is done first).
+func (repo *MemoryRepo) WithTx(ctx context.Context, fn func(tx Repo) error) error {
+	if repo.tx != nil {
+		return fn(repo)
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	tx := &memoryTx{}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.rollback()
+		}
+	}()
+
+	err := fn(&MemoryRepo{mu: repo.mu, data: repo.data, deletedIds: repo.deletedIds, tx: tx})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+func (repo *MemoryRepo) List(ctx context.Context, query RepoQuery) ([]*RepoItem, error) {
+	items := []*RepoItem{}
+	if query.Cursor != nil && query.Cursor.Id != "" && len(query.Cursor.Values) != len(query.Sort) {
+		return items, NewRepoError(ErrInvalid, "list", fmt.Errorf("cursor does not match the sort order"))
+	}
+
+	var found []*RepoItem
+	repo.read(func(d *memoryData) {
+		for _, stored := range d.items {
+			if matches(&stored.RepoItem, stored.deleted, query) {
+				item := stored.RepoItem
+				found = append(found, &item)
+			}
+		}
+	})
+	return sortPage(found, query), nil
+}
+
+func (repo *MemoryRepo) Count(ctx context.Context, query RepoQuery) (int, error) {
+	count := 0
+	repo.read(func(d *memoryData) {
+		for _, item := range d.items {
+			if matches(&item.RepoItem, item.deleted, query) {
+				count++
+			}
+		}
+	})
+	return count, nil
+}
+
+func (repo *MemoryRepo) Fetch(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	var found *memoryItem
+	repo.read(func(d *memoryData) {
+		found = d.items[item.Id]
+	})
+	if found == nil {
+		return &RepoItem{}, NewRepoError(ErrNotFound, "fetch", nil)
+	}
+	if found.deleted {
+		return &RepoItem{}, repo.deletedError("fetch")
+	}
+	fetched := found.RepoItem
+	return &fetched, nil
+}
+
+// deletedError is the error returned when reaching a soft-deleted item,
+// depending on the deleted ids policy.
+func (repo *MemoryRepo) deletedError(op string) error {
+	if repo.deletedIds == DeletedIdsReuse {
+		return NewRepoError(ErrNotFound, op, nil)
+	}
+	return NewRepoError(ErrGone, op, nil)
+}
+
+// nextVersion is the version an item is created at, unless its id is
+// taken by a live item, or by a deleted one and deleted ids are forbidden.
+func (repo *MemoryRepo) nextVersion(found *memoryItem, op string) (int, error) {
+	switch {
+	case found == nil:
+		return 0, nil
+	case !found.deleted:
+		return 0, NewRepoError(ErrDuplicateId, op, nil)
+	case repo.deletedIds != DeletedIdsReuse:
+		return 0, NewRepoError(ErrGone, op, nil)
+	default:
+		return found.Version + 1, nil
+	}
+}
+
+func (repo *MemoryRepo) create(d *memoryData, tx *memoryTx, item *RepoItem, version int, now int64) {
+	stored := &memoryItem{RepoItem: RepoItem{
+		Id:           item.Id,
+		Version:      version,
+		Organisation: item.Organisation,
+		Status:       item.Status,
+		Attributes:   item.Attributes,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}}
+	// a deleted item being replaced takes its history along, as the new
+	// one may belong to another organisation
+	tx.removeVersions(d, item.Id)
+	tx.putItem(d, stored)
+	repo.recordVersion(d, tx, OperationCreate, stored, item.Audit)
+	item.Version = version
+	item.CreatedAt, item.UpdatedAt = now, now
+}
+
+func (repo *MemoryRepo) Create(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	err := repo.write(func(d *memoryData, tx *memoryTx) error {
+		version, err := repo.nextVersion(d.items[item.Id], "create")
+		if err != nil {
+			return err
+		}
+		repo.create(d, tx, item, version, NowMillis())
+		return nil
+	})
+	return item, err
+}
+
+func (repo *MemoryRepo) CreateMany(ctx context.Context, items []*RepoItem, atomic bool) ([]error, error) {
+	errs := make([]error, len(items))
+	err := repo.write(func(d *memoryData, tx *memoryTx) error {
+		versions := make([]int, len(items))
+		seen := make(map[string]bool)
+		failed := false
+		for i, item := range items {
+			if seen[item.Id] {
+				errs[i] = NewRepoError(ErrDuplicateId, "create many", nil)
+			} else {
+				versions[i], errs[i] = repo.nextVersion(d.items[item.Id], "create many")
+			}
+			seen[item.Id] = true
+			failed = failed || errs[i] != nil
+		}
+
+		if atomic && failed {
+			return nil
+		}
+		now := NowMillis()
+		for i, item := range items {
+			if errs[i] == nil {
+				repo.create(d, tx, item, versions[i], now)
+			}
+		}
+		return nil
+	})
+	return errs, err
+}
+
+func (repo *MemoryRepo) Update(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	err := repo.write(func(d *memoryData, tx *memoryTx) error {
+		found := d.items[item.Id]
+		if found == nil || found.deleted || found.Version != item.Version {
+			return NewRepoError(ErrConflict, "update", nil)
+		}
+		stored := &memoryItem{RepoItem: found.RepoItem}
+		stored.Attributes, stored.Status = item.Attributes, item.Status
+		stored.Version++
+		stored.UpdatedAt = NowMillis()
+		tx.putItem(d, stored)
+		repo.recordVersion(d, tx, OperationUpdate, stored, item.Audit)
+
+		item.Version = stored.Version
+		item.UpdatedAt = stored.UpdatedAt
+		return nil
+	})
+	return item, err
+}
+
+// Delete soft-deletes an item, as a new version.
+func (repo *MemoryRepo) Delete(ctx context.Context, item *RepoItem) error {
+	return repo.write(func(d *memoryData, tx *memoryTx) error {
+		found := d.items[item.Id]
+		if found == nil || found.deleted || found.Version != item.Version {
+			return NewRepoError(ErrConflict, "delete", nil)
+		}
+		stored := &memoryItem{RepoItem: found.RepoItem, deleted: true}
+		stored.Version++
+		stored.DeletedAt = NowMillis()
+		tx.putItem(d, stored)
+		repo.recordVersion(d, tx, OperationDelete, stored, item.Audit)
+		return nil
+	})
+}
+
+// Undelete restores a soft-deleted item, as a new version.
+func (repo *MemoryRepo) Undelete(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	var restored RepoItem
+	err := repo.write(func(d *memoryData, tx *memoryTx) error {
+		found := d.items[item.Id]
+		if found == nil || !found.deleted {
+			return NewRepoError(ErrNotFound, "undelete", nil)
+		}
+		stored := &memoryItem{RepoItem: found.RepoItem}
+		stored.Version++
+		stored.DeletedAt = 0
+		stored.UpdatedAt = NowMillis()
+		tx.putItem(d, stored)
+		repo.recordVersion(d, tx, OperationUndelete, stored, item.Audit)
+		restored = stored.RepoItem
+		return nil
+	})
+	if err != nil {
+		return item, err
+	}
+	return &restored, nil
+}
+
+// Purge removes for good the items soft-deleted at or before a time, returning
+// how many were removed, along with their history.
+func (repo *MemoryRepo) Purge(ctx context.Context, deletedBefore int64) (int, error) {
+	purged := 0
+	err := repo.write(func(d *memoryData, tx *memoryTx) error {
+		for id, item := range d.items {
+			if item.deleted && item.DeletedAt <= deletedBefore {
+				tx.removeItem(d, id)
+				tx.removeVersions(d, id)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (repo *MemoryRepo) DeleteAll(ctx context.Context) error {
+	return repo.write(func(d *memoryData, tx *memoryTx) error {
+		tx.clear(d)
+		return nil
+	})
+}
+
+// recordVersion snapshots the stored item, as left by an operation.
+func (repo *MemoryRepo) recordVersion(d *memoryData, tx *memoryTx, operation string, stored *memoryItem, audit RepoAudit) {
+	v := &RepoVersion{Item: stored.RepoItem, Operation: operation, RecordedAt: NowMillis()}
+	v.Item.Audit = audit
+	tx.addVersion(d, v)
+}
+
+func (repo *MemoryRepo) History(ctx context.Context, id string) ([]*RepoVersion, error) {
+	versions := []*RepoVersion{}
+	repo.read(func(d *memoryData) {
+		for _, v := range d.versions[id] {
+			version := *v
+			versions = append(versions, &version)
+		}
+	})
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Item.Version < versions[j].Item.Version
+	})
+
+	if len(versions) == 0 {
+		return versions, NewRepoError(ErrNotFound, "history", nil)
+	}
+	return versions, nil
+}
+
+func (repo *MemoryRepo) CreateIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	return repo.write(func(d *memoryData, tx *memoryTx) error {
+		if _, ok := d.idempotency[idempotencyKey{record.Key, record.Organisation}]; ok {
+			return NewRepoError(ErrDuplicateId, "create idempotency record", nil)
+		}
+		stored := *record
+		tx.putIdempotencyRecord(d, &stored)
+		return nil
+	})
+}
+
+func (repo *MemoryRepo) FetchIdempotencyRecord(ctx context.Context, key string, organisation string) (*IdempotencyRecord, error) {
+	var found *IdempotencyRecord
+	repo.read(func(d *memoryData) {
+		found = d.idempotency[idempotencyKey{key, organisation}]
+	})
+	if found == nil {
+		return &IdempotencyRecord{}, NewRepoError(ErrNotFound, "fetch idempotency record", nil)
+	}
+	fetched := *found
+	return &fetched, nil
+}
+
+func (repo *MemoryRepo) UpdateIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	return repo.write(func(d *memoryData, tx *memoryTx) error {
+		found := d.idempotency[idempotencyKey{record.Key, record.Organisation}]
+		if found == nil {
+			return NewRepoError(ErrNotFound, "update idempotency record", nil)
+		}
+		updated := *found
+		updated.StatusCode, updated.ContentType, updated.Body = record.StatusCode, record.ContentType, record.Body
+		updated.Headers = record.Headers
+		tx.putIdempotencyRecord(d, &updated)
+		return nil
+	})
+}
+
+func (repo *MemoryRepo) DeleteIdempotencyRecord(ctx context.Context, key string, organisation string) error {
+	return repo.write(func(d *memoryData, tx *memoryTx) error {
+		tx.removeIdempotencyRecord(d, idempotencyKey{key, organisation})
+		return nil
+	})
+}
+
+func (repo *MemoryRepo) PurgeIdempotencyRecords(ctx context.Context, expiredBefore int64) (int, error) {
+	purged := 0
+	err := repo.write(func(d *memoryData, tx *memoryTx) error {
+		for k, record := range d.idempotency {
+			if record.ExpiresAt <= expiredBefore {
+				tx.removeIdempotencyRecord(d, k)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,300 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var memoryRepoItems = []*RepoItem{
+	{Id: "a", Organisation: "org1", Status: "created", Attributes: `{"amount":"10.00","currency":"GBP","reference":"Rent"}`},
+	{Id: "b", Organisation: "org1", Status: "created", Attributes: `{"amount":"2.50","currency":"EUR","reference":"rental car"}`},
+	{Id: "c", Organisation: "org2", Status: "approved", Attributes: `{"amount":"100","currency":"GBP"}`},
+	{Id: "d", Organisation: "org1", Status: "created", Attributes: `{"reference":"groceries"}`},
+}
+
+func newMemoryRepo(t *testing.T, deletedIds DeletedIds) Repo {
+	repo, err := NewMemoryRepo(RepoConfig{Driver: "memory", DeletedIds: deletedIds})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, item := range memoryRepoItems {
+		created := *item
+		if _, err := repo.Create(context.Background(), &created); err != nil {
+			t.Fatalf("%s: unexpected error %v", item.Id, err)
+		}
+	}
+	return repo
+}
+
+func ids(items []*RepoItem) []string {
+	ids := []string{}
+	for _, item := range items {
+		ids = append(ids, item.Id)
+	}
+	return ids
+}
+
+func expectIds(t *testing.T, name string, items []*RepoItem, expected ...string) {
+	if expected == nil {
+		expected = []string{}
+	}
+	if actual := ids(items); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("%s: expected %v, got %v", name, expected, actual)
+	}
+}
+
+func TestMemoryRepoListFilters(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryRepo(t, DeletedIdsForbid)
+
+	for _, test := range []struct {
+		name     string
+		query    RepoQuery
+		expected []string
+	}{
+		{"no filter", RepoQuery{}, []string{"a", "b", "c", "d"}},
+		{"organisation", RepoQuery{Organisation: "org1"}, []string{"a", "b", "d"}},
+		{"status", RepoQuery{Status: "approved"}, []string{"c"}},
+		{"currency", RepoQuery{Currency: "GBP"}, []string{"a", "c"}},
+		{"minimum amount, as a number", RepoQuery{AmountMin: "5"}, []string{"a", "c"}},
+		{"maximum amount, inclusive", RepoQuery{AmountMax: "10"}, []string{"a", "b"}},
+		{"amount range", RepoQuery{AmountMin: "2.5", AmountMax: "99.99"}, []string{"a", "b"}},
+		{"reference, ignoring case", RepoQuery{Reference: "RENT"}, []string{"a", "b"}},
+		{"several filters", RepoQuery{Organisation: "org1", Currency: "GBP"}, []string{"a"}},
+		{"no match", RepoQuery{Organisation: "org3"}, nil},
+		{"offset", RepoQuery{Offset: 3}, []string{"d"}},
+	} {
+		query := test.query
+		if query.Limit == 0 {
+			query.Limit = 10
+		}
+		items, err := repo.List(ctx, query)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		expectIds(t, test.name, items, test.expected...)
+
+		if test.query.Offset == 0 {
+			count, err := repo.Count(ctx, test.query)
+			if err != nil || count != len(test.expected) {
+				t.Errorf("%s: expected to count %d, got %d (%v)", test.name, len(test.expected), count, err)
+			}
+		}
+	}
+
+	if err := repo.Delete(ctx, &RepoItem{Id: "d", Version: 0}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	items, _ := repo.List(ctx, RepoQuery{Limit: 10})
+	expectIds(t, "live", items, "a", "b", "c")
+	items, _ = repo.List(ctx, RepoQuery{Limit: 10, Deleted: true})
+	expectIds(t, "deleted", items, "d")
+}
+
+func TestMemoryRepoListSort(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryRepo(t, DeletedIdsForbid)
+
+	for _, test := range []struct {
+		name     string
+		sort     []RepoSort
+		expected []string
+	}{
+		{"by amount, as numbers", []RepoSort{{Field: "amount", Attribute: true, Numeric: true}}, []string{"d", "b", "a", "c"}},
+		{"by amount, descending", []RepoSort{{Field: "amount", Attribute: true, Numeric: true, Descending: true}}, []string{"c", "a", "b", "d"}},
+		{"by currency, then id", []RepoSort{{Field: "currency", Attribute: true}}, []string{"d", "b", "a", "c"}},
+		{"by organisation descending, then status", []RepoSort{{Field: "organisation", Descending: true}, {Field: "status"}}, []string{"c", "a", "b", "d"}},
+	} {
+		items, err := repo.List(ctx, RepoQuery{Limit: 10, Sort: test.sort})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		expectIds(t, test.name, items, test.expected...)
+	}
+}
+
+func TestMemoryRepoListCursor(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryRepo(t, DeletedIdsForbid)
+	byAmount := []RepoSort{{Field: "amount", Attribute: true, Numeric: true}}
+
+	for _, test := range []struct {
+		name     string
+		cursor   *RepoCursor
+		expected []string
+	}{
+		{"first page", nil, []string{"d", "b"}},
+		{"next page", &RepoCursor{Id: "b", Values: []string{"2.50"}}, []string{"a", "c"}},
+		{"previous page", &RepoCursor{Id: "a", Values: []string{"10.00"}, Backward: true}, []string{"d", "b"}},
+		{"last page", &RepoCursor{Backward: true}, []string{"a", "c"}},
+		{"past the end", &RepoCursor{Id: "c", Values: []string{"100"}}, nil},
+	} {
+		items, err := repo.List(ctx, RepoQuery{Limit: 2, Sort: byAmount, Cursor: test.cursor})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		expectIds(t, test.name, items, test.expected...)
+	}
+
+	_, err := repo.List(ctx, RepoQuery{Limit: 2, Cursor: &RepoCursor{Id: "b", Values: []string{"2.50"}}})
+	if !IsInvalid(err) {
+		t.Errorf("expected a cursor of another sort order to be invalid, got %v", err)
+	}
+}
+
+func TestMemoryRepoUpdate(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryRepo(t, DeletedIdsForbid)
+
+	updated, err := repo.Update(ctx, &RepoItem{Id: "a", Version: 0, Status: "created", Attributes: `{"amount":"11.00"}`})
+	if err != nil || updated.Version != 1 {
+		t.Fatalf("expected version 1, got %v (%v)", updated, err)
+	}
+	found, _ := repo.Fetch(ctx, &RepoItem{Id: "a"})
+	if found.Version != 1 || found.Attributes != `{"amount":"11.00"}` || found.Organisation != "org1" {
+		t.Errorf("expected the update to be stored, got %+v", found)
+	}
+
+	if err := repo.Delete(ctx, &RepoItem{Id: "b", Version: 0}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for name, item := range map[string]*RepoItem{
+		"stale version":  {Id: "a", Version: 0},
+		"future version": {Id: "a", Version: 5},
+		"missing item":   {Id: "x", Version: 0},
+		"deleted item":   {Id: "b", Version: 1},
+	} {
+		if _, err := repo.Update(ctx, item); !IsConflict(err) {
+			t.Errorf("%s: expected a conflict, got %v", name, err)
+		}
+	}
+}
+
+func TestMemoryRepoDeleteUndelete(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryRepo(t, DeletedIdsForbid)
+
+	if err := repo.Delete(ctx, &RepoItem{Id: "a", Version: 1}); !IsConflict(err) {
+		t.Errorf("expected deleting a stale version to conflict, got %v", err)
+	}
+	if err := repo.Delete(ctx, &RepoItem{Id: "a", Version: 0}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := repo.Fetch(ctx, &RepoItem{Id: "a"}); RepoErrorKind(err) != ErrGone {
+		t.Errorf("expected a deleted item to be gone, got %v", err)
+	}
+	if _, err := repo.Create(ctx, &RepoItem{Id: "a", Organisation: "org2"}); RepoErrorKind(err) != ErrGone {
+		t.Errorf("expected a deleted id to be forbidden, got %v", err)
+	}
+	if err := repo.Delete(ctx, &RepoItem{Id: "a", Version: 1}); !IsConflict(err) {
+		t.Errorf("expected deleting twice to conflict, got %v", err)
+	}
+
+	restored, err := repo.Undelete(ctx, &RepoItem{Id: "a"})
+	if err != nil || restored.Version != 2 || restored.DeletedAt != 0 {
+		t.Fatalf("expected version 2 to be restored, got %v (%v)", restored, err)
+	}
+	if _, err := repo.Undelete(ctx, &RepoItem{Id: "a"}); !IsNotFound(err) {
+		t.Errorf("expected undeleting a live item to find nothing, got %v", err)
+	}
+
+	history, err := repo.History(ctx, "a")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var operations []string
+	var versions []int
+	for _, v := range history {
+		operations = append(operations, v.Operation)
+		versions = append(versions, v.Item.Version)
+	}
+	if !reflect.DeepEqual(operations, []string{OperationCreate, OperationDelete, OperationUndelete}) || !reflect.DeepEqual(versions, []int{0, 1, 2}) {
+		t.Errorf("expected a create, a delete and an undelete, got %v at versions %v", operations, versions)
+	}
+}
+
+func TestMemoryRepoReuse(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryRepo(t, DeletedIdsReuse)
+
+	if err := repo.Delete(ctx, &RepoItem{Id: "a", Version: 0}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := repo.Fetch(ctx, &RepoItem{Id: "a"}); !IsNotFound(err) {
+		t.Errorf("expected a deleted item not to be found, got %v", err)
+	}
+
+	created, err := repo.Create(ctx, &RepoItem{Id: "a", Organisation: "org2", Status: "created", Attributes: `{}`})
+	if err != nil || created.Version != 2 {
+		t.Fatalf("expected the item to be created at version 2, got %v (%v)", created, err)
+	}
+	history, _ := repo.History(ctx, "a")
+	if len(history) != 1 || history[0].Item.Organisation != "org2" {
+		t.Errorf("expected the history to start over, got %d versions", len(history))
+	}
+}
+
+func TestMemoryRepoPurge(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryRepo(t, DeletedIdsForbid)
+
+	if err := repo.Delete(ctx, &RepoItem{Id: "a", Version: 0}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	deleted, _ := repo.List(ctx, RepoQuery{Limit: 10, Deleted: true})
+	deletedAt := deleted[0].DeletedAt
+
+	if purged, err := repo.Purge(ctx, deletedAt-1); err != nil || purged != 0 {
+		t.Errorf("expected items deleted later to be kept, purged %d (%v)", purged, err)
+	}
+	if purged, err := repo.Purge(ctx, deletedAt); err != nil || purged != 1 {
+		t.Errorf("expected 1 item to be purged, purged %d (%v)", purged, err)
+	}
+	if _, err := repo.Fetch(ctx, &RepoItem{Id: "a"}); !IsNotFound(err) {
+		t.Errorf("expected a purged item not to be found, got %v", err)
+	}
+	if _, err := repo.History(ctx, "a"); !IsNotFound(err) {
+		t.Errorf("expected the history of a purged item to go, got %v", err)
+	}
+	if count, _ := repo.Count(ctx, RepoQuery{}); count != 3 {
+		t.Errorf("expected live items to be kept, got %d", count)
+	}
+
+	created, err := repo.Create(ctx, &RepoItem{Id: "a", Organisation: "org2"})
+	if err != nil || created.Version != 0 {
+		t.Errorf("expected a purged id to be created anew, got %v (%v)", created, err)
+	}
+}
+
+func TestMemoryRepoWithTx(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryRepo(t, DeletedIdsForbid)
+	failure := errors.New("failure")
+
+	err := repo.WithTx(ctx, func(tx Repo) error {
+		if _, err := tx.Create(ctx, &RepoItem{Id: "e", Organisation: "org1"}); err != nil {
+			return err
+		}
+		if err := tx.Delete(ctx, &RepoItem{Id: "a", Version: 0}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("expected the transaction to fail, got %v", err)
+	}
+	if _, err := repo.Fetch(ctx, &RepoItem{Id: "e"}); !IsNotFound(err) {
+		t.Errorf("expected the create to be rolled back, got %v", err)
+	}
+	if found, err := repo.Fetch(ctx, &RepoItem{Id: "a"}); err != nil || found.Version != 0 {
+		t.Errorf("expected the delete to be rolled back, got %v (%v)", found, err)
+	}
+	if history, _ := repo.History(ctx, "a"); len(history) != 1 {
+		t.Errorf("expected the history to be rolled back, got %d versions", len(history))
+	}
+}
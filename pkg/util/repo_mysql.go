@@ -0,0 +1,124 @@
+package util
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate"
+	migratemysql "github.com/golang-migrate/migrate/database/mysql"
+	_ "github.com/golang-migrate/migrate/source/file"
+	"github.com/pkg/errors"
+)
+
+type MysqlRepo struct {
+	SqlRepo
+	config *mysql.Config
+}
+
+// NewMysqlRepo connects to a MySQL or MariaDB database, given a DSN such as
+// user:password@tcp(localhost:3306)/payments. Its migrations are kept apart
+// from the others, in the mysql directory of the migrations.
+func NewMysqlRepo(config RepoConfig) (Repo, error) {
+	dsn, err := mysql.ParseDSN(config.Uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid database uri")
+	}
+	// updates count the rows they match, rather than the rows they change,
+	// as conflicts are told apart by updating no rows
+	dsn.ClientFoundRows = true
+
+	repo := &MysqlRepo{
+		SqlRepo: SqlRepo{
+			schema:         config.Schema,
+			translateError: translateMysqlError,
+			deletedIds:     config.DeletedIds,
+			attributeExpr:  mysqlAttributeExpr,
+			bulkInsert:     multiRowInsert,
+			positional:     true,
+			numericExpr:    mysqlNumericExpr,
+			txOptions:      &sql.TxOptions{Isolation: sql.LevelRepeatableRead},
+		},
+		config: dsn,
+	}
+
+	if config.Migrations != "" {
+		source, err := migrationsSource(config.Migrations, "mysql")
+		if err != nil {
+			return repo, err
+		}
+		err = migrateMysql(*dsn, source)
+		if err != nil {
+			return repo, err
+		}
+	}
+
+	database, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return repo, errors.Wrap(err, "Unable to connect to the database")
+	}
+
+	repo.db = database
+	return repo, nil
+}
+
+// migrateMysql syncs the database on a connection of its own, which the
+// migration driver closes when done.
+func migrateMysql(dsn mysql.Config, migrations string) error {
+	dsn.MultiStatements = true
+	database, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return errors.Wrap(err, "Unable to connect to the database")
+	}
+
+	driver, err := migratemysql.WithInstance(database, &migratemysql.Config{})
+	if err != nil {
+		database.Close()
+		return errors.Wrap(err, "Could not start migration")
+	}
+
+	m, err := migrate.NewWithDatabaseInstance(migrations, "mysql", driver)
+	if err != nil {
+		driver.Close()
+		return errors.Wrap(err, "Migration failed")
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return errors.Wrap(err, "Error while syncing")
+	}
+	return nil
+}
+
+func (repo *MysqlRepo) Description() string {
+	return fmt.Sprintf("mysql (%s(%s)/%s)", repo.config.Net, repo.config.Addr, repo.config.DBName)
+}
+
+func translateMysqlError(err error) error {
+	if err == mysql.ErrInvalidConn {
+		return ErrUnavailable
+	}
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return nil
+	}
+	switch mysqlErr.Number {
+	case 1062: // ER_DUP_ENTRY
+		return ErrDuplicateId
+	case 1205, 1213: // ER_LOCK_WAIT_TIMEOUT, ER_LOCK_DEADLOCK
+		return ErrConflict
+	case 1040, 1053: // ER_CON_COUNT_ERROR, ER_SERVER_SHUTDOWN
+		return ErrUnavailable
+	case 1048, 1264, 1364, 1366, 1406: // bad null, out of range, no default, bad value, too long
+		return ErrInvalid
+	default:
+		return nil
+	}
+}
+
+func mysqlNumericExpr(expr string) string {
+	return fmt.Sprintf("CAST(%s AS DECIMAL(65, 30))", expr)
+}
+
+func mysqlAttributeExpr(key string) string {
+	return fmt.Sprintf("NULLIF(JSON_UNQUOTE(JSON_EXTRACT(attributes, '$.%s')), '')", key)
+}
@@ -1,14 +1,16 @@
 package util
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/golang-migrate/migrate"
 	"github.com/golang-migrate/migrate/database/postgres"
 	_ "github.com/golang-migrate/migrate/source/file"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
+	"strings"
 )
 
 type PosgresRepo struct {
@@ -20,7 +22,13 @@ func NewPostgresRepo(config RepoConfig) (Repo, error) {
 
 	repo := &PosgresRepo{
 		SqlRepo: SqlRepo{
-			schema: config.Schema,
+			schema:         config.Schema,
+			translateError: translatePostgresError,
+			deletedIds:     config.DeletedIds,
+			attributeExpr:  postgresAttributeExpr,
+			attributeEq:    postgresAttributeEq,
+			bulkInsert:     postgresCopyInsert,
+			txOptions:      &sql.TxOptions{Isolation: sql.LevelRepeatableRead},
 		},
 		uri: config.Uri,
 	}
@@ -31,14 +39,17 @@ func NewPostgresRepo(config RepoConfig) (Repo, error) {
 	}
 
 	if config.Migrations != "" {
+		source, err := migrationsSource(config.Migrations, "postgres")
+		if err != nil {
+			return repo, err
+		}
+
 		driver, err := postgres.WithInstance(database, &postgres.Config{})
 		if err != nil {
 			return repo, errors.Wrap(err, "Could not start migration")
 		}
 
-		m, err := migrate.NewWithDatabaseInstance(
-			fmt.Sprintf("file://%s", config.Migrations),
-			"postgres", driver)
+		m, err := migrate.NewWithDatabaseInstance(source, "postgres", driver)
 
 		if err != nil {
 			return repo, errors.Wrap(err, "Migration failed")
@@ -56,3 +67,75 @@ func NewPostgresRepo(config RepoConfig) (Repo, error) {
 func (repo *PosgresRepo) Description() string {
 	return fmt.Sprintf("postgres (%s)", repo.uri)
 }
+
+func translatePostgresError(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return nil
+	}
+	switch {
+	case pqErr.Code == "23505":
+		return ErrDuplicateId
+	case pqErr.Code.Class() == "40":
+		// serialization failures and deadlocks between transactions
+		return ErrConflict
+	case pqErr.Code.Class() == "08", pqErr.Code.Class() == "53", pqErr.Code.Class() == "57":
+		return ErrUnavailable
+	case pqErr.Code.Class() == "22", pqErr.Code.Class() == "23":
+		return ErrInvalid
+	default:
+		return nil
+	}
+}
+
+// postgresAttributeExpr extracts attributes as the expression indexes of
+// the migrations do, so filters and sorts can use them. Amounts that are
+// not decimals, stored before they were validated, are taken to be missing
+// rather than failing their cast to numbers.
+func postgresAttributeExpr(key string) string {
+	if key == "amount" {
+		return fmt.Sprintf("CASE WHEN attributes ->> '%s' ~ '%s' THEN attributes ->> '%s' END", key, postgresDecimalPattern, key)
+	}
+	return fmt.Sprintf("NULLIF(attributes ->> '%s', '')", key)
+}
+
+const postgresDecimalPattern = `^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]{1,3})?$`
+
+// postgresAttributeEq matches attributes by containment, which their GIN
+// index supports.
+func postgresAttributeEq(key string, param string) string {
+	return fmt.Sprintf("attributes @> jsonb_build_object('%s', %s::text)", key, param)
+}
+
+// postgresCopyInsert streams new items into a table with COPY.
+func postgresCopyInsert(ctx context.Context, tx sqlConn, table string, items []*RepoItem, now int64) error {
+	if len(items) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, copyIn(table, "id", "version", "organisation", "status", "attributes", "created_at", "updated_at"))
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		_, err = stmt.ExecContext(ctx, item.Id, 0, item.Organisation, item.Status, item.Attributes, now, now)
+		if err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
+
+// copyIn is the COPY statement of a table, which may be qualified by its
+// schema (eg. public.payments): each part is quoted on its own.
+func copyIn(table string, columns ...string) string {
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		return pq.CopyInSchema(table[:i], table[i+1:], columns...)
+	}
+	return pq.CopyIn(table, columns...)
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCopyIn(t *testing.T) {
+	for table, expected := range map[string]string{
+		"payments":        `COPY "payments" ("id", "version") FROM STDIN`,
+		"public.payments": `COPY "public"."payments" ("id", "version") FROM STDIN`,
+	} {
+		if stmt := copyIn(table, "id", "version"); stmt != expected {
+			t.Errorf("%s: expected %s, got %s", table, expected, stmt)
+		}
+	}
+}
+
+func TestPostgresAmountIndexes(t *testing.T) {
+	migration, err := ioutil.ReadFile("../../schema/postgres/09_attribute_indexes.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &SqlRepo{attributeExpr: postgresAttributeExpr}
+	for _, expr := range []string{
+		repo.numeric(repo.attributeExpr("amount")),
+		repo.sortExpr(RepoSort{Field: "amount", Attribute: true, Numeric: true}),
+	} {
+		if !strings.Contains(string(migration), "(("+expr+")") {
+			t.Errorf("no index on %s", expr)
+		}
+	}
+}
+
+func TestPostgresDecimalPattern(t *testing.T) {
+	pattern := regexp.MustCompile(postgresDecimalPattern)
+	for amount, expected := range map[string]bool{
+		"10":      true,
+		"-10.25":  true,
+		"1e3":     true,
+		"1.5E-2":  true,
+		"":        false,
+		"Inf":     false,
+		"NaN":     false,
+		"0x1p4":   false,
+		"1.":      false,
+		"1e99999": false,
+		" 1":      false,
+	} {
+		if pattern.MatchString(amount) != expected {
+			t.Errorf("%q: expected a match to be %v", amount, expected)
+		}
+	}
+}
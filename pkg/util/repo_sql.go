@@ -1,61 +1,107 @@
 package util
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/golang-migrate/migrate/source/file"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
-	"strings"
 )
 
 var (
 	countStmtTemplate     string
+	countAnyStmtTemplate  string
 	deleteAllStmtTemplate string
 	listStmtTemplate      string
 	fetchStmtTemplate     string
+	findStmtTemplate      string
+	reuseStmtTemplate     string
 	createStmtTemplate    string
 	updateStmtTemplate    string
 	deleteOneStmtTemplate string
+	undeleteStmtTemplate  string
+	purgeStmtTemplate     string
 )
 
 func init() {
 	countStmtTemplate = "SELECT COUNT(*) FROM %s WHERE deleted = 0"
+	countAnyStmtTemplate = "SELECT COUNT(*) FROM %s"
 	deleteAllStmtTemplate = "DELETE FROM %s"
-	listStmtTemplate = "SELECT id, version, organisation, attributes FROM %s  WHERE deleted = 0 LIMIT $1 OFFSET $2"
-	fetchStmtTemplate = "SELECT id, version, organisation, attributes FROM %s WHERE id = $1 AND deleted = 0"
-	createStmtTemplate = "INSERT INTO %s (id, version, organisation, attributes) VALUES ($1, $2, $3, $4)"
-	updateStmtTemplate = "UPDATE %s SET attributes=$1, version=$2 WHERE id=$3 AND version=$4"
-	deleteOneStmtTemplate = "UPDATE %s SET deleted=1 WHERE id=$1 AND version=$2"
+	listStmtTemplate = "SELECT id, version, organisation, status, attributes, created_at, updated_at, deleted_at FROM %s"
+	fetchStmtTemplate = "SELECT id, version, organisation, status, attributes, created_at, updated_at, deleted_at, deleted FROM %s WHERE id = $1"
+	findStmtTemplate = "SELECT version, deleted FROM %s WHERE id = $1"
+	reuseStmtTemplate = "UPDATE %s SET version=$1, organisation=$2, status=$3, attributes=$4, created_at=$5, updated_at=$6, deleted=0, deleted_at=0 WHERE id=$7 AND deleted=1"
+	createStmtTemplate = "INSERT INTO %s (id, version, organisation, status, attributes, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	updateStmtTemplate = "UPDATE %s SET attributes=$1, status=$2, version=$3, updated_at=$4 WHERE id=$5 AND version=$6 AND deleted=0"
+	deleteOneStmtTemplate = "UPDATE %s SET deleted=1, deleted_at=$1, version=version+1 WHERE id=$2 AND version=$3 AND deleted=0"
+	undeleteStmtTemplate = "UPDATE %s SET deleted=0, deleted_at=0, version=version+1, updated_at=$1 WHERE id=$2 AND deleted=1"
+	purgeStmtTemplate = "DELETE FROM %s WHERE deleted=1 AND deleted_at <= $1"
 }
 
 type SqlRepo struct {
-	db            *sql.DB
-	schema        string
-	countStmt     string
-	deleteAllStmt string
-	listStmt      string
-	fetchStmt     string
-	createStmt    string
-	updateStmt    string
-	deleteOneStmt string
+	db             *sql.DB
+	tx             *sql.Tx
+	txOptions      *sql.TxOptions
+	schema         string
+	translateError ErrorTranslator
+	attributeExpr  AttributeExpr
+	attributeEq    AttributeEq
+	deletedIds     DeletedIds
+	bulkInsert     BulkInsert
+	positional     bool
+	numericExpr    NumericExpr
+	countStmt      string
+	countAnyStmt   string
+	deleteAllStmt  string
+	listStmt       string
+	fetchStmt      string
+	findStmt       string
+	reuseStmt      string
+	createStmt     string
+	updateStmt     string
+	deleteOneStmt  string
+	undeleteStmt   string
+	purgeStmt      string
+	idempotency    idempotencyStmts
+	versions       versionStmts
 }
 
 func (repo *SqlRepo) fmtTemplate(tpl string) string {
 	return fmt.Sprintf(tpl, repo.schema)
 }
 
+// dbError classifies a driver error, wrapping it into a RepoError when the
+// backend recognises it.
+func (repo *SqlRepo) dbError(op string, err error) error {
+	kind := translateCommonError(err)
+	if kind == nil && repo.translateError != nil {
+		kind = repo.translateError(err)
+	}
+	if kind == nil {
+		return errors.Wrap(err, op)
+	}
+	return NewRepoError(kind, op, err)
+}
+
 func (repo *SqlRepo) Init() error {
 	if repo.schema == "" {
 		return fmt.Errorf("no schema defined")
 	}
 	repo.countStmt = repo.fmtTemplate(countStmtTemplate)
+	repo.countAnyStmt = repo.fmtTemplate(countAnyStmtTemplate)
 	repo.deleteAllStmt = repo.fmtTemplate(deleteAllStmtTemplate)
 	repo.listStmt = repo.fmtTemplate(listStmtTemplate)
 	repo.fetchStmt = repo.fmtTemplate(fetchStmtTemplate)
+	repo.findStmt = repo.fmtTemplate(findStmtTemplate)
+	repo.reuseStmt = repo.fmtTemplate(reuseStmtTemplate)
 	repo.createStmt = repo.fmtTemplate(createStmtTemplate)
 	repo.updateStmt = repo.fmtTemplate(updateStmtTemplate)
 	repo.deleteOneStmt = repo.fmtTemplate(deleteOneStmtTemplate)
+	repo.undeleteStmt = repo.fmtTemplate(undeleteStmtTemplate)
+	repo.purgeStmt = repo.fmtTemplate(purgeStmtTemplate)
+	repo.initIdempotencyStmts()
+	repo.initVersionStmts()
 	return nil
 }
 
@@ -63,166 +109,276 @@ func (repo *SqlRepo) Close() error {
 	return repo.db.Close()
 }
 
-func (repo *SqlRepo) Check() error {
-	return repo.db.Ping()
+func (repo *SqlRepo) Check(ctx context.Context) error {
+	err := repo.db.PingContext(ctx)
+	if err != nil {
+		return NewRepoError(ErrUnavailable, "check", err)
+	}
+	return nil
 }
 
-func (repo *SqlRepo) List(offset int, limit int) ([]*RepoItem, error) {
+func (repo *SqlRepo) List(ctx context.Context, query RepoQuery) ([]*RepoItem, error) {
 	items := []*RepoItem{}
-	rows, err := repo.db.Query(repo.listStmt, limit, offset)
+	if query.Cursor != nil && query.Cursor.Id != "" && len(query.Cursor.Values) != len(query.Sort) {
+		return items, NewRepoError(ErrInvalid, "list", fmt.Errorf("cursor does not match the sort order"))
+	}
+	where, args := repo.where(query)
+	args = append(args, query.Limit, query.Offset)
+	stmt := fmt.Sprintf("%s WHERE %s ORDER BY %s LIMIT $%d OFFSET $%d", repo.listStmt, where, repo.orderBy(query), len(args)-1, len(args))
+	rows, err := repo.conn().QueryContext(ctx, stmt, args...)
 	if err != nil {
-		return items, errors.Wrap(err, repo.listStmt)
+		return items, repo.dbError(stmt, err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		item := &RepoItem{}
-		err := rows.Scan(&item.Id, &item.Version, &item.Organisation, &item.Attributes)
+		err := rows.Scan(&item.Id, &item.Version, &item.Organisation, &item.Status, &item.Attributes,
+			&item.CreatedAt, &item.UpdatedAt, &item.DeletedAt)
 		if err != nil {
 			return items, errors.Wrap(err, "Error parsing database row")
 		}
 		items = append(items, item)
 	}
+
+	if query.Cursor != nil && query.Cursor.Backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
 	return items, nil
 }
 
-func (repo *SqlRepo) Fetch(item *RepoItem) (*RepoItem, error) {
+func (repo *SqlRepo) Count(ctx context.Context, query RepoQuery) (int, error) {
+	var count int
+	query.Cursor = nil
+	where, args := repo.where(query)
+	stmt := fmt.Sprintf("%s WHERE %s", repo.countAnyStmt, where)
+	err := repo.conn().QueryRowContext(ctx, stmt, args...).Scan(&count)
+	if err != nil {
+		return 0, repo.dbError(stmt, err)
+	}
+	return count, nil
+}
+
+func (repo *SqlRepo) Fetch(ctx context.Context, item *RepoItem) (*RepoItem, error) {
 	found := &RepoItem{}
 
-	rows, err := repo.db.Query(repo.fetchStmt, item.Id)
+	rows, err := repo.conn().QueryContext(ctx, repo.fetchStmt, item.Id)
 	if err != nil {
-		return found, errors.Wrap(err, repo.fetchStmt)
+		return found, repo.dbError(repo.fetchStmt, err)
 	}
 
 	defer rows.Close()
 
 	for rows.Next() {
-		err := rows.Scan(&found.Id, &found.Version, &found.Organisation, &found.Attributes)
+		var deleted int
+		err := rows.Scan(&found.Id, &found.Version, &found.Organisation, &found.Status, &found.Attributes,
+			&found.CreatedAt, &found.UpdatedAt, &found.DeletedAt, &deleted)
 		if err != nil {
 			return found, errors.Wrap(err, "Error parsing database row")
 		}
 
+		if deleted != 0 {
+			return &RepoItem{}, repo.deletedError("fetch")
+		}
 		return found, nil
 
 	}
 
-	return found, fmt.Errorf("DB_NOT_FOUND")
+	return found, NewRepoError(ErrNotFound, "fetch", nil)
 }
 
-func (repo *SqlRepo) Create(item *RepoItem) (*RepoItem, error) {
-	stmt, err := repo.db.Prepare(repo.createStmt)
-	if err != nil {
-		return item, errors.Wrap(err, repo.createStmt)
+// deletedError is the error returned when reaching a soft-deleted item,
+// depending on the deleted ids policy.
+func (repo *SqlRepo) deletedError(op string) error {
+	if repo.deletedIds == DeletedIdsReuse {
+		return NewRepoError(ErrNotFound, op, nil)
 	}
+	return NewRepoError(ErrGone, op, nil)
+}
 
-	defer stmt.Close()
-	_, err = stmt.Exec(item.Id, 0, item.Organisation, item.Attributes)
-	if err != nil {
-		errorCode := "DB_ERROR"
-		if strings.Contains(strings.ToLower(err.Error()), "unique constraint") {
-			errorCode = "DB_CONFLICT"
+// Create inserts a new item, unless its id is taken by a live item, or by
+// a deleted one and deleted ids are forbidden. Otherwise the deleted item
+// is replaced, as its next version.
+func (repo *SqlRepo) Create(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	now := NowMillis()
+	version := 0
+	err := repo.inTx(ctx, "create", func(tx sqlConn) error {
+		var deleted int
+		err := tx.QueryRowContext(ctx, repo.findStmt, item.Id).Scan(&version, &deleted)
+		switch {
+		case err == sql.ErrNoRows:
+			version = 0
+			_, err = tx.ExecContext(ctx, repo.createStmt, item.Id, version, item.Organisation, item.Status, item.Attributes, now, now)
+		case err != nil:
+		case deleted == 0:
+			return NewRepoError(ErrDuplicateId, "create", nil)
+		case repo.deletedIds != DeletedIdsReuse:
+			return NewRepoError(ErrGone, "create", nil)
+		default:
+			version++
+			err = repo.reuse(ctx, tx, item, version, now)
+		}
+		if err != nil {
+			return repo.dbError("create", err)
 		}
-		return item, errors.Wrap(err, errorCode)
+		return repo.recordVersion(ctx, tx, OperationCreate, item)
+	})
+	if err != nil {
+		return item, err
 	}
 
-	item.Version = 0
+	item.Version = version
+	item.CreatedAt, item.UpdatedAt = now, now
 	return item, nil
 }
 
-func (repo *SqlRepo) Update(item *RepoItem) (*RepoItem, error) {
-	stmt, err := repo.db.Prepare(repo.updateStmt)
+// reuse replaces a deleted item with a new one, at the given version. The
+// history of the deleted item goes along, as the new one may belong to
+// another organisation.
+func (repo *SqlRepo) reuse(ctx context.Context, tx sqlConn, item *RepoItem, version int, now int64) error {
+	_, err := tx.ExecContext(ctx, repo.versions.removeStmt, item.Id)
 	if err != nil {
-		return item, errors.Wrap(err, repo.updateStmt)
+		return err
 	}
+	_, err = tx.ExecContext(ctx, repo.reuseStmt, version, item.Organisation, item.Status, item.Attributes, now, now, item.Id)
+	return err
+}
 
-	defer stmt.Close()
-
+func (repo *SqlRepo) Update(ctx context.Context, item *RepoItem) (*RepoItem, error) {
 	newVersion := item.Version + 1
+	now := NowMillis()
 
-	res, err := stmt.Exec(item.Attributes, newVersion, item.Id, item.Version)
+	err := repo.inTx(ctx, "update", func(tx sqlConn) error {
+		res, err := tx.ExecContext(ctx, repo.updateStmt, item.Attributes, item.Status, newVersion, now, item.Id, item.Version)
+		if err != nil {
+			return repo.dbError("update", err)
+		}
+		err = checkRowsAffected("update", res)
+		if err != nil {
+			return err
+		}
+		return repo.recordVersion(ctx, tx, OperationUpdate, item)
+	})
 	if err != nil {
-		errorCode := "DB_ERROR"
-		return item, errors.Wrap(err, errorCode)
+		return item, err
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		errorCode := "DB_ERROR"
-		return item, errors.Wrap(err, errorCode)
-	}
+	item.Version = newVersion
+	item.UpdatedAt = now
+	return item, nil
+}
 
-	switch rowsAffected {
-	case 0:
-		return item, errors.New("DB_CONFLICT")
-	case 1:
-		item.Version = newVersion
-		return item, nil
-	default:
-		return item, fmt.Errorf("DB_ERROR: more than 1 row affected by update: %v", rowsAffected)
-	}
+// Delete soft-deletes an item, as a new version, so the snapshot recorded
+// along can be told apart from the one of its last update.
+func (repo *SqlRepo) Delete(ctx context.Context, item *RepoItem) error {
+	return repo.inTx(ctx, "delete", func(tx sqlConn) error {
+		res, err := tx.ExecContext(ctx, repo.deleteOneStmt, NowMillis(), item.Id, item.Version)
+		if err != nil {
+			return repo.dbError("delete", err)
+		}
+		err = checkRowsAffected("delete", res)
+		if err != nil {
+			return err
+		}
+		return repo.recordVersion(ctx, tx, OperationDelete, item)
+	})
 }
 
-func (repo *SqlRepo) Delete(item *RepoItem) error {
-	stmt, err := repo.db.Prepare(repo.deleteOneStmt)
+// Undelete restores a soft-deleted item, as a new version.
+func (repo *SqlRepo) Undelete(ctx context.Context, item *RepoItem) (*RepoItem, error) {
+	err := repo.inTx(ctx, "undelete", func(tx sqlConn) error {
+		res, err := tx.ExecContext(ctx, repo.undeleteStmt, NowMillis(), item.Id)
+		if err != nil {
+			return repo.dbError("undelete", err)
+		}
+		err = checkRowsAffected("undelete", res)
+		if IsConflict(err) {
+			return NewRepoError(ErrNotFound, "undelete", nil)
+		}
+		if err != nil {
+			return err
+		}
+		return repo.recordVersion(ctx, tx, OperationUndelete, item)
+	})
 	if err != nil {
-		return errors.Wrap(err, repo.deleteOneStmt)
+		return item, err
 	}
+	return repo.Fetch(ctx, item)
+}
 
-	defer stmt.Close()
-	res, err := stmt.Exec(item.Id, item.Version)
-	if err != nil {
-		errorCode := "DB_ERROR"
-		return errors.Wrap(err, errorCode)
-	}
+// Purge removes for good the items soft-deleted at or before a time, returning
+// how many were removed, along with their history.
+func (repo *SqlRepo) Purge(ctx context.Context, deletedBefore int64) (int, error) {
+	var purged int64
+	err := repo.inTx(ctx, "purge", func(tx sqlConn) error {
+		// the history goes along with the payments, as their ids may be
+		// used again, by anyone
+		_, err := tx.ExecContext(ctx, repo.versions.purgeStmt, deletedBefore)
+		if err != nil {
+			return repo.dbError("purge", err)
+		}
+		res, err := tx.ExecContext(ctx, repo.purgeStmt, deletedBefore)
+		if err != nil {
+			return repo.dbError("purge", err)
+		}
+		purged, err = res.RowsAffected()
+		return errors.Wrap(err, "purge")
+	})
+	return int(purged), err
+}
 
+// checkRowsAffected makes sure a write matched exactly one item, at the
+// expected version.
+func checkRowsAffected(op string, res sql.Result) error {
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		errorCode := "DB_ERROR"
-		return errors.Wrap(err, errorCode)
+		return errors.Wrap(err, op)
 	}
 
 	switch rowsAffected {
 	case 0:
-		return errors.New("DB_NOT_FOUND")
+		return NewRepoError(ErrConflict, op, nil)
 	case 1:
 		return nil
 	default:
-		return fmt.Errorf("DB_ERROR: more than 1 row affected by delete: %v", rowsAffected)
+		return fmt.Errorf("more than 1 row affected by %s: %v", op, rowsAffected)
 	}
 }
 
-func (repo *SqlRepo) IsConflict(err error) bool {
-	return strings.Contains(err.Error(), "DB_CONFLICT")
-}
-
-func (repo *SqlRepo) IsNotFound(err error) bool {
-	return strings.Contains(err.Error(), "DB_NOT_FOUND")
-}
-
-func (repo *SqlRepo) DeleteAll() error {
-	stmt, err := repo.db.Prepare(repo.deleteAllStmt)
+func (repo *SqlRepo) DeleteAll(ctx context.Context) error {
+	stmt, err := repo.conn().PrepareContext(ctx, repo.deleteAllStmt)
 	if err != nil {
 		return errors.Wrap(err, repo.deleteAllStmt)
 	}
 
 	defer stmt.Close()
 
-	_, err = stmt.Exec()
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return repo.dbError("delete all", err)
+	}
+
+	_, err = repo.conn().ExecContext(ctx, repo.idempotency.deleteAllStmt)
+	if err != nil {
+		return repo.dbError("delete all", err)
+	}
+
+	_, err = repo.conn().ExecContext(ctx, repo.versions.deleteAllStmt)
 	if err != nil {
-		errorCode := "DB_ERROR"
-		// TODO: better translate errors
-		return errors.Wrap(err, errorCode)
+		return repo.dbError("delete all", err)
 	}
 
 	return nil
 }
 
-func (repo *SqlRepo) Info() (RepoInfo, error) {
+func (repo *SqlRepo) Info(ctx context.Context) (RepoInfo, error) {
 	var count int
 	var info RepoInfo
 
-	rows, err := repo.db.Query(repo.countStmt)
+	rows, err := repo.conn().QueryContext(ctx, repo.countStmt)
 	if err != nil {
-		return info, errors.Wrap(err, repo.countStmt)
+		return info, repo.dbError(repo.countStmt, err)
 	}
 
 	defer rows.Close()
@@ -0,0 +1,242 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// batchSize is the number of items inserted per statement, keeping well
+// below the number of parameters SQLite accepts.
+const batchSize = 100
+
+// BulkInsert inserts new items, all at once, into a table.
+type BulkInsert func(ctx context.Context, tx sqlConn, table string, items []*RepoItem, now int64) error
+
+// multiRowInsert inserts items with multi-row INSERT statements.
+func multiRowInsert(ctx context.Context, tx sqlConn, table string, items []*RepoItem, now int64) error {
+	for _, chunk := range chunks(items) {
+		var rows []string
+		var args []interface{}
+		for _, item := range chunk {
+			var params []string
+			for _, arg := range []interface{}{item.Id, 0, item.Organisation, item.Status, item.Attributes, now, now} {
+				args = append(args, arg)
+				params = append(params, fmt.Sprintf("$%d", len(args)))
+			}
+			rows = append(rows, "("+strings.Join(params, ", ")+")")
+		}
+		stmt := fmt.Sprintf("INSERT INTO %s (id, version, organisation, status, attributes, created_at, updated_at) VALUES %s", table, strings.Join(rows, ", "))
+		_, err := tx.ExecContext(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func chunks(items []*RepoItem) [][]*RepoItem {
+	var chunks [][]*RepoItem
+	for len(items) > batchSize {
+		chunks = append(chunks, items[:batchSize])
+		items = items[batchSize:]
+	}
+	if len(items) > 0 {
+		chunks = append(chunks, items)
+	}
+	return chunks
+}
+
+func inList(items []*RepoItem, first int) (string, []interface{}) {
+	params := make([]string, len(items))
+	args := make([]interface{}, len(items))
+	for i, item := range items {
+		params[i] = fmt.Sprintf("$%d", first+i)
+		args[i] = item.Id
+	}
+	return "(" + strings.Join(params, ", ") + ")", args
+}
+
+// CreateMany creates several items at once. When atomic, either every item
+// is created, or none is. Otherwise, items are created independently. The
+// returned errors tell why each item could not be created (nil when it
+// was), while the error fails the whole batch.
+func (repo *SqlRepo) CreateMany(ctx context.Context, items []*RepoItem, atomic bool) ([]error, error) {
+	errs := make([]error, len(items))
+	now := NowMillis()
+
+	err := repo.inTx(ctx, "create many", func(tx sqlConn) error {
+		existing, err := repo.findMany(ctx, tx, items)
+		if err != nil {
+			return err
+		}
+
+		var inserted []*RepoItem
+		var insertedAt []int
+		var reused []*RepoItem
+		seen := make(map[string]bool)
+		for i, item := range items {
+			found, ok := existing[item.Id]
+			switch {
+			case seen[item.Id]:
+				errs[i] = NewRepoError(ErrDuplicateId, "create many", nil)
+			case !ok:
+				item.Version = 0
+				inserted = append(inserted, item)
+				insertedAt = append(insertedAt, i)
+			case found.deleted == 0:
+				errs[i] = NewRepoError(ErrDuplicateId, "create many", nil)
+			case repo.deletedIds != DeletedIdsReuse:
+				errs[i] = NewRepoError(ErrGone, "create many", nil)
+			default:
+				item.Version = found.version + 1
+				reused = append(reused, item)
+			}
+			seen[item.Id] = true
+		}
+
+		if atomic {
+			for _, err := range errs {
+				if err != nil {
+					return errBatchFailed
+				}
+			}
+		}
+
+		if atomic {
+			err = repo.bulkInsert(ctx, tx, repo.schema, inserted, now)
+		} else {
+			inserted, err = repo.insertEach(ctx, tx, inserted, insertedAt, errs, now)
+		}
+		if err != nil {
+			return repo.dbError("create many", err)
+		}
+		for _, item := range reused {
+			err = repo.reuse(ctx, tx, item, item.Version, now)
+			if err != nil {
+				return repo.dbError("create many", err)
+			}
+		}
+		return repo.recordVersions(ctx, tx, OperationCreate, append(inserted, reused...))
+	})
+
+	if err == errBatchFailed {
+		return errs, nil
+	}
+	if err != nil {
+		return errs, err
+	}
+	for i, item := range items {
+		if errs[i] == nil {
+			item.CreatedAt, item.UpdatedAt = now, now
+		}
+	}
+	return errs, nil
+}
+
+// insertEach inserts new items, which may have been inserted concurrently
+// since they were found missing. Should any of them be, the items are
+// inserted one at a time instead, and those already there reported as
+// duplicates, at their index in errs, rather than failing the whole batch.
+// It returns the items inserted.
+func (repo *SqlRepo) insertEach(ctx context.Context, tx sqlConn, items []*RepoItem, indexes []int, errs []error, now int64) ([]*RepoItem, error) {
+	err := repo.savepoint(ctx, tx, func() error {
+		return repo.bulkInsert(ctx, tx, repo.schema, items, now)
+	})
+	if err == nil || !IsDuplicateId(repo.dbError("create many", err)) {
+		return items, err
+	}
+
+	var inserted []*RepoItem
+	for i, item := range items {
+		err = repo.savepoint(ctx, tx, func() error {
+			return repo.bulkInsert(ctx, tx, repo.schema, []*RepoItem{item}, now)
+		})
+		switch {
+		case err == nil:
+			inserted = append(inserted, item)
+		case IsDuplicateId(repo.dbError("create many", err)):
+			errs[indexes[i]] = NewRepoError(ErrDuplicateId, "create many", nil)
+		default:
+			return nil, err
+		}
+	}
+	return inserted, nil
+}
+
+// savepoint runs a write within a transaction, rolling back only that
+// write when it fails, so the transaction can go on.
+func (repo *SqlRepo) savepoint(ctx context.Context, tx sqlConn, write func() error) error {
+	_, err := tx.ExecContext(ctx, "SAVEPOINT create_many")
+	if err != nil {
+		return err
+	}
+	err = write()
+	if err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT create_many"); rollbackErr != nil {
+			return rollbackErr
+		}
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT create_many")
+	return err
+}
+
+// errBatchFailed rolls back an atomic batch, when any of its items fails.
+var errBatchFailed = fmt.Errorf("batch failed")
+
+type foundItem struct {
+	version int
+	deleted int
+}
+
+func (repo *SqlRepo) findMany(ctx context.Context, tx sqlConn, items []*RepoItem) (map[string]foundItem, error) {
+	found := make(map[string]foundItem)
+	for _, chunk := range chunks(items) {
+		in, args := inList(chunk, 1)
+		stmt := fmt.Sprintf("SELECT id, version, deleted FROM %s WHERE id IN %s", repo.schema, in)
+		rows, err := tx.QueryContext(ctx, stmt, args...)
+		if err != nil {
+			return nil, repo.dbError(stmt, err)
+		}
+		for rows.Next() {
+			var id string
+			var f foundItem
+			err = rows.Scan(&id, &f.version, &f.deleted)
+			if err != nil {
+				rows.Close()
+				return nil, repo.dbError(stmt, err)
+			}
+			found[id] = f
+		}
+		rows.Close()
+	}
+	return found, nil
+}
+
+// recordVersions snapshots several stored items at once, each one with
+// its own audit, recording together the items sharing one.
+func (repo *SqlRepo) recordVersions(ctx context.Context, tx sqlConn, operation string, items []*RepoItem) error {
+	var audits []RepoAudit
+	byAudit := make(map[RepoAudit][]*RepoItem)
+	for _, item := range items {
+		if _, ok := byAudit[item.Audit]; !ok {
+			audits = append(audits, item.Audit)
+		}
+		byAudit[item.Audit] = append(byAudit[item.Audit], item)
+	}
+
+	recordedAt := NowMillis()
+	for _, audit := range audits {
+		for _, chunk := range chunks(byAudit[audit]) {
+			in, args := inList(chunk, 5)
+			stmt := fmt.Sprintf("INSERT INTO %[1]s_versions (id, version, operation, organisation, status, attributes, created_at, updated_at, deleted_at, actor, request_id, recorded_at) "+
+				"SELECT id, version, $1, organisation, status, attributes, created_at, updated_at, deleted_at, $2, $3, $4 FROM %[1]s WHERE id IN %s", repo.schema, in)
+			_, err := tx.ExecContext(ctx, stmt, append([]interface{}{operation, audit.Actor, audit.RequestId, recordedAt}, args...)...)
+			if err != nil {
+				return repo.dbError("record versions", err)
+			}
+		}
+	}
+	return nil
+}
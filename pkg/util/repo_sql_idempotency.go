@@ -0,0 +1,145 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+)
+
+var (
+	createIdempotencyStmtTemplate    string
+	fetchIdempotencyStmtTemplate     string
+	updateIdempotencyStmtTemplate    string
+	deleteIdempotencyStmtTemplate    string
+	deleteAllIdempotencyStmtTemplate string
+	purgeIdempotencyStmtTemplate     string
+)
+
+func init() {
+	createIdempotencyStmtTemplate = "INSERT INTO %s_idempotency (idempotency_key, organisation, request_hash, status_code, content_type, body, headers, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	fetchIdempotencyStmtTemplate = "SELECT idempotency_key, organisation, request_hash, status_code, content_type, body, headers, expires_at FROM %s_idempotency WHERE idempotency_key = $1 AND organisation = $2"
+	updateIdempotencyStmtTemplate = "UPDATE %s_idempotency SET status_code=$1, content_type=$2, body=$3, headers=$4 WHERE idempotency_key=$5 AND organisation=$6"
+	deleteIdempotencyStmtTemplate = "DELETE FROM %s_idempotency WHERE idempotency_key=$1 AND organisation=$2"
+	deleteAllIdempotencyStmtTemplate = "DELETE FROM %s_idempotency"
+	purgeIdempotencyStmtTemplate = "DELETE FROM %s_idempotency WHERE expires_at <= $1"
+}
+
+type idempotencyStmts struct {
+	createStmt    string
+	fetchStmt     string
+	updateStmt    string
+	deleteStmt    string
+	deleteAllStmt string
+	purgeStmt     string
+}
+
+func (repo *SqlRepo) initIdempotencyStmts() {
+	repo.idempotency = idempotencyStmts{
+		createStmt:    repo.fmtTemplate(createIdempotencyStmtTemplate),
+		fetchStmt:     repo.fmtTemplate(fetchIdempotencyStmtTemplate),
+		updateStmt:    repo.fmtTemplate(updateIdempotencyStmtTemplate),
+		deleteStmt:    repo.fmtTemplate(deleteIdempotencyStmtTemplate),
+		deleteAllStmt: repo.fmtTemplate(deleteAllIdempotencyStmtTemplate),
+		purgeStmt:     repo.fmtTemplate(purgeIdempotencyStmtTemplate),
+	}
+}
+
+// encodeHeaders keeps replayed headers as a JSON object, or an empty
+// string when there are none.
+func encodeHeaders(headers map[string]string) (string, error) {
+	if len(headers) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(headers)
+	return string(encoded), err
+}
+
+func decodeHeaders(encoded string) (map[string]string, error) {
+	headers := map[string]string{}
+	if encoded == "" {
+		return headers, nil
+	}
+	err := json.Unmarshal([]byte(encoded), &headers)
+	return headers, err
+}
+
+func (repo *SqlRepo) CreateIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	headers, err := encodeHeaders(record.Headers)
+	if err != nil {
+		return err
+	}
+	_, err = repo.conn().ExecContext(ctx, repo.idempotency.createStmt, record.Key, record.Organisation, record.RequestHash,
+		record.StatusCode, record.ContentType, record.Body, headers, record.ExpiresAt)
+	if err != nil {
+		return repo.dbError("create idempotency record", err)
+	}
+	return nil
+}
+
+func (repo *SqlRepo) FetchIdempotencyRecord(ctx context.Context, key string, organisation string) (*IdempotencyRecord, error) {
+	found := &IdempotencyRecord{}
+
+	rows, err := repo.conn().QueryContext(ctx, repo.idempotency.fetchStmt, key, organisation)
+	if err != nil {
+		return found, repo.dbError(repo.idempotency.fetchStmt, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var headers string
+		err := rows.Scan(&found.Key, &found.Organisation, &found.RequestHash, &found.StatusCode,
+			&found.ContentType, &found.Body, &headers, &found.ExpiresAt)
+		if err != nil {
+			return found, repo.dbError("Error parsing database row", err)
+		}
+		found.Headers, err = decodeHeaders(headers)
+		if err != nil {
+			return found, repo.dbError("Error parsing database row", err)
+		}
+		return found, nil
+	}
+
+	return found, NewRepoError(ErrNotFound, "fetch idempotency record", nil)
+}
+
+func (repo *SqlRepo) UpdateIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	headers, err := encodeHeaders(record.Headers)
+	if err != nil {
+		return err
+	}
+	res, err := repo.conn().ExecContext(ctx, repo.idempotency.updateStmt, record.StatusCode, record.ContentType, record.Body,
+		headers, record.Key, record.Organisation)
+	if err != nil {
+		return repo.dbError("update idempotency record", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return repo.dbError("update idempotency record", err)
+	}
+
+	if rowsAffected == 0 {
+		return NewRepoError(ErrNotFound, "update idempotency record", nil)
+	}
+	return nil
+}
+
+func (repo *SqlRepo) DeleteIdempotencyRecord(ctx context.Context, key string, organisation string) error {
+	_, err := repo.conn().ExecContext(ctx, repo.idempotency.deleteStmt, key, organisation)
+	if err != nil {
+		return repo.dbError("delete idempotency record", err)
+	}
+	return nil
+}
+
+func (repo *SqlRepo) PurgeIdempotencyRecords(ctx context.Context, expiredBefore int64) (int, error) {
+	res, err := repo.conn().ExecContext(ctx, repo.idempotency.purgeStmt, expiredBefore)
+	if err != nil {
+		return 0, repo.dbError("purge idempotency records", err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, repo.dbError("purge idempotency records", err)
+	}
+	return int(purged), nil
+}
@@ -0,0 +1,22 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// migrationsSource is the source of the migrations of a SQL repo, kept in
+// a directory named after its driver, under the migrations path. Sqlite3
+// and Postgres migrations used to be shared, at the top of that path: such
+// a path is refused, rather than leaving the database on an older schema.
+func migrationsSource(path string, driver string) (string, error) {
+	dir := filepath.Join(path, driver)
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return fmt.Sprintf("file://%s", dir), nil
+	}
+	if old, _ := filepath.Glob(filepath.Join(path, "*.up.sql")); len(old) > 0 {
+		return "", fmt.Errorf("%s holds migrations shared by every repo, which are now kept in a directory per repo: point the migrations path at a directory holding %s", path, driver)
+	}
+	return "", fmt.Errorf("no %s migrations found in %s", driver, dir)
+}
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// positionalConn runs statements written with numbered placeholders on a
+// backend that only understands positional ones, such as MySQL.
+type positionalConn struct {
+	conn sqlConn
+}
+
+func (c positionalConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, args = positional(query, args)
+	return c.conn.ExecContext(ctx, query, args...)
+}
+
+func (c positionalConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query, args = positional(query, args)
+	return c.conn.QueryContext(ctx, query, args...)
+}
+
+func (c positionalConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query, args = positional(query, args)
+	return c.conn.QueryRowContext(ctx, query, args...)
+}
+
+// PrepareContext only rewrites the statement, so the placeholders of
+// prepared statements must appear in order, and once each.
+func (c positionalConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	query, _ = positional(query, nil)
+	return c.conn.PrepareContext(ctx, query)
+}
+
+// positional replaces each $N placeholder of a statement, outside string
+// literals, with ?, and lists the arguments in the order they now appear:
+// a placeholder used twice gets its argument twice.
+func positional(query string, args []interface{}) (string, []interface{}) {
+	var b strings.Builder
+	var bound []interface{}
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if c == '\'' {
+			quoted = !quoted
+		}
+		if c != '$' || quoted {
+			b.WriteByte(c)
+			continue
+		}
+		j := i + 1
+		for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+			j++
+		}
+		n, err := strconv.Atoi(query[i+1 : j])
+		if err != nil {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('?')
+		if n >= 1 && n <= len(args) {
+			bound = append(bound, args[n-1])
+		}
+		i = j - 1
+	}
+	return b.String(), bound
+}
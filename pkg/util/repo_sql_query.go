@@ -0,0 +1,150 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AttributeExpr returns the SQL expression extracting a top level member of
+// the attributes column as text, or NULL when missing. Keys never come from
+// user input.
+type AttributeExpr func(key string) string
+
+// AttributeEq returns the SQL condition selecting items with a top level
+// member of their attributes equal to the text bound to param. Backends
+// set it when they can index such conditions better than they can index
+// their AttributeExpr.
+type AttributeEq func(key string, param string) string
+
+// where translates a query into a parameterised WHERE clause, with its
+// arguments bound to $1, $2, ...
+func (repo *SqlRepo) where(query RepoQuery) (string, []interface{}) {
+	conditions := []string{"deleted = 0"}
+	if query.Deleted {
+		conditions[0] = "deleted = 1"
+	}
+	args := []interface{}{}
+	param := func(arg interface{}) string {
+		args = append(args, arg)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if query.Cursor != nil && query.Cursor.Id != "" {
+		conditions = append(conditions, repo.after(query, param))
+	}
+	if query.Organisation != "" {
+		conditions = append(conditions, "organisation = "+param(query.Organisation))
+	}
+	if query.Status != "" {
+		conditions = append(conditions, "status = "+param(query.Status))
+	}
+	if query.Currency != "" {
+		conditions = append(conditions, repo.attributeEquals("currency", param(query.Currency)))
+	}
+	if query.AmountMin != "" {
+		conditions = append(conditions, repo.numeric(repo.attributeExpr("amount"))+" >= "+repo.numeric(param(query.AmountMin)))
+	}
+	if query.AmountMax != "" {
+		conditions = append(conditions, repo.numeric(repo.attributeExpr("amount"))+" <= "+repo.numeric(param(query.AmountMax)))
+	}
+	ranges := []struct {
+		column string
+		op     string
+		value  int64
+	}{
+		{"created_at", ">=", query.CreatedAfter},
+		{"created_at", "<", query.CreatedBefore},
+		{"updated_at", ">=", query.UpdatedAfter},
+		{"updated_at", "<", query.UpdatedBefore},
+	}
+	for _, r := range ranges {
+		if r.value != 0 {
+			conditions = append(conditions, fmt.Sprintf("%s %s %s", r.column, r.op, param(r.value)))
+		}
+	}
+	if query.Reference != "" {
+		pattern := "%" + escapeLike(strings.ToLower(query.Reference)) + "%"
+		conditions = append(conditions, fmt.Sprintf(`LOWER(%s) LIKE %s ESCAPE '!'`, repo.attributeExpr("reference"), param(pattern)))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern with !, rather than a
+// backslash, which MySQL string literals would need escaped too.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func (repo *SqlRepo) attributeEquals(key string, param string) string {
+	if repo.attributeEq != nil {
+		return repo.attributeEq(key, param)
+	}
+	return repo.attributeExpr(key) + " = " + param
+}
+
+// NumericExpr returns the SQL expression converting text to a number, to
+// compare amounts.
+type NumericExpr func(expr string) string
+
+func (repo *SqlRepo) numeric(expr string) string {
+	if repo.numericExpr != nil {
+		return repo.numericExpr(expr)
+	}
+	return fmt.Sprintf("CAST(%s AS NUMERIC)", expr)
+}
+
+// orderBy returns the ORDER BY clause of a query, which is reversed when
+// paginating backwards.
+func (repo *SqlRepo) orderBy(query RepoQuery) string {
+	backward := query.Cursor != nil && query.Cursor.Backward
+	var terms []string
+	for _, sort := range sortKeys(query) {
+		dir := "ASC"
+		if sort.Descending != backward {
+			dir = "DESC"
+		}
+		terms = append(terms, repo.sortExpr(sort)+" "+dir)
+	}
+	return strings.Join(terms, ", ")
+}
+
+// after returns the keyset condition selecting the items found after the
+// query cursor, in the query order (or before it, when backward): for
+// sort keys a, b, id, that is a > $1 OR (a = $1 AND b > $2) OR ...
+func (repo *SqlRepo) after(query RepoQuery, param func(interface{}) string) string {
+	keys := sortKeys(query)
+	values := append(append([]string{}, query.Cursor.Values...), query.Cursor.Id)
+
+	var alternatives []string
+	var equal []string
+	for i, sort := range keys {
+		expr := repo.sortExpr(sort)
+		value := param(values[i])
+		if sort.Numeric {
+			value = repo.numeric(value)
+		}
+		op := ">"
+		if sort.Descending != query.Cursor.Backward {
+			op = "<"
+		}
+		alternatives = append(alternatives, "("+strings.Join(append(equal, expr+" "+op+" "+value), " AND ")+")")
+		equal = append(equal, expr+" = "+value)
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// sortKeys is the query sort, with id breaking ties.
+func sortKeys(query RepoQuery) []RepoSort {
+	return append(append([]RepoSort{}, query.Sort...), RepoSort{Field: "id"})
+}
+
+func (repo *SqlRepo) sortExpr(sort RepoSort) string {
+	if !sort.Attribute {
+		return sort.Field
+	}
+	if sort.Numeric {
+		return repo.numeric(fmt.Sprintf("COALESCE(%s, '0')", repo.attributeExpr(sort.Field)))
+	}
+	return fmt.Sprintf("COALESCE(%s, '')", repo.attributeExpr(sort.Field))
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// sqlConn is what statements run on: either the database, or the
+// transaction a repo is bound to.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+func (repo *SqlRepo) conn() sqlConn {
+	if repo.tx != nil {
+		return repo.bind(repo.tx)
+	}
+	return repo.bind(repo.db)
+}
+
+// bind adapts a connection to the placeholders of the backend: statements
+// are written with $1, $2, ... which some only understand as ?.
+func (repo *SqlRepo) bind(conn sqlConn) sqlConn {
+	if !repo.positional {
+		return conn
+	}
+	return positionalConn{conn}
+}
+
+// WithTx runs fn with a repo bound to a new transaction, committed when fn
+// succeeds, and rolled back otherwise (or when ctx is done first).
+func (repo *SqlRepo) WithTx(ctx context.Context, fn func(tx Repo) error) error {
+	tx, err := repo.db.BeginTx(ctx, repo.txOptions)
+	if err != nil {
+		return repo.dbError("begin", err)
+	}
+
+	txRepo := &sqlTxRepo{SqlRepo: *repo}
+	txRepo.tx = tx
+
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	err = fn(txRepo)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return repo.dbError("commit", err)
+	}
+	committed = true
+	return nil
+}
+
+// sqlTxRepo is the repo handed to WithTx callbacks. Nested transactions
+// join the current one.
+type sqlTxRepo struct {
+	SqlRepo
+}
+
+func (repo *sqlTxRepo) Description() string {
+	return "transaction"
+}
+
+func (repo *sqlTxRepo) Close() error {
+	return fmt.Errorf("a transaction cannot close its repo")
+}
+
+func (repo *sqlTxRepo) WithTx(ctx context.Context, fn func(tx Repo) error) error {
+	return fn(repo)
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+var (
+	recordVersionStmtTemplate     string
+	listVersionsStmtTemplate      string
+	deleteAllVersionsStmtTemplate string
+	purgeVersionsStmtTemplate     string
+	removeVersionsStmtTemplate    string
+)
+
+func init() {
+	recordVersionStmtTemplate = "INSERT INTO %[1]s_versions (id, version, operation, organisation, status, attributes, created_at, updated_at, deleted_at, actor, request_id, recorded_at) " +
+		"SELECT id, version, $1, organisation, status, attributes, created_at, updated_at, deleted_at, $2, $3, $4 FROM %[1]s WHERE id = $5"
+	listVersionsStmtTemplate = "SELECT id, version, operation, organisation, status, attributes, created_at, updated_at, deleted_at, actor, request_id, recorded_at " +
+		"FROM %s_versions WHERE id = $1 ORDER BY version, recorded_at"
+	deleteAllVersionsStmtTemplate = "DELETE FROM %s_versions"
+	purgeVersionsStmtTemplate = "DELETE FROM %[1]s_versions WHERE id IN (SELECT id FROM %[1]s WHERE deleted=1 AND deleted_at <= $1)"
+	removeVersionsStmtTemplate = "DELETE FROM %s_versions WHERE id = $1"
+}
+
+type versionStmts struct {
+	recordStmt    string
+	listStmt      string
+	deleteAllStmt string
+	purgeStmt     string
+	removeStmt    string
+}
+
+func (repo *SqlRepo) initVersionStmts() {
+	repo.versions = versionStmts{
+		recordStmt:    repo.fmtTemplate(recordVersionStmtTemplate),
+		listStmt:      repo.fmtTemplate(listVersionsStmtTemplate),
+		deleteAllStmt: repo.fmtTemplate(deleteAllVersionsStmtTemplate),
+		purgeStmt:     repo.fmtTemplate(purgeVersionsStmtTemplate),
+		removeStmt:    repo.fmtTemplate(removeVersionsStmtTemplate),
+	}
+}
+
+// inTx runs a write and the snapshot it records in a single transaction,
+// joining the one the repo is bound to, if any.
+func (repo *SqlRepo) inTx(ctx context.Context, op string, write func(tx sqlConn) error) error {
+	if repo.tx != nil {
+		return write(repo.conn())
+	}
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return repo.dbError(op, err)
+	}
+	err = write(repo.bind(tx))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return repo.dbError(op, err)
+	}
+	return nil
+}
+
+// recordVersion snapshots the stored item, as left by an operation.
+func (repo *SqlRepo) recordVersion(ctx context.Context, tx sqlConn, operation string, item *RepoItem) error {
+	_, err := tx.ExecContext(ctx, repo.versions.recordStmt, operation, item.Audit.Actor, item.Audit.RequestId, NowMillis(), item.Id)
+	if err != nil {
+		return repo.dbError("record version", err)
+	}
+	return nil
+}
+
+func (repo *SqlRepo) History(ctx context.Context, id string) ([]*RepoVersion, error) {
+	versions := []*RepoVersion{}
+
+	rows, err := repo.conn().QueryContext(ctx, repo.versions.listStmt, id)
+	if err != nil {
+		return versions, repo.dbError(repo.versions.listStmt, err)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		v := &RepoVersion{}
+		err := rows.Scan(&v.Item.Id, &v.Item.Version, &v.Operation, &v.Item.Organisation, &v.Item.Status, &v.Item.Attributes,
+			&v.Item.CreatedAt, &v.Item.UpdatedAt, &v.Item.DeletedAt, &v.Item.Audit.Actor, &v.Item.Audit.RequestId, &v.RecordedAt)
+		if err != nil {
+			return versions, errors.Wrap(err, "Error parsing database row")
+		}
+		versions = append(versions, v)
+	}
+
+	if len(versions) == 0 {
+		return versions, NewRepoError(ErrNotFound, "history", nil)
+	}
+	return versions, nil
+}
@@ -1,15 +1,30 @@
+//go:build cgo
+// +build cgo
+
 package util
 
 import (
 	"database/sql"
 	"fmt"
 	"github.com/golang-migrate/migrate"
-	"github.com/golang-migrate/migrate/database/sqlite3"
+	migratesqlite3 "github.com/golang-migrate/migrate/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/source/file"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
 )
 
+// sqlite3Driver registers json_extract on every connection, as SQLite is
+// only built with its JSON1 extension when using the sqlite_json tag.
+const sqlite3Driver = "sqlite3_payments"
+
+func init() {
+	sql.Register(sqlite3Driver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("json_extract", jsonExtract, true)
+		},
+	})
+}
+
 type Sqlite3Repo struct {
 	SqlRepo
 	backend string
@@ -23,25 +38,33 @@ func NewSqlite3Repo(config RepoConfig) (Repo, error) {
 
 	repo := &Sqlite3Repo{
 		SqlRepo: SqlRepo{
-			schema: config.Schema,
+			schema:         config.Schema,
+			translateError: translateSqlite3Error,
+			deletedIds:     config.DeletedIds,
+			attributeExpr:  sqlite3AttributeExpr,
+			numericExpr:    sqlite3NumericExpr,
+			bulkInsert:     multiRowInsert,
 		},
 		backend: backend,
 	}
 
-	database, err := sql.Open("sqlite3", backend)
+	database, err := sql.Open(sqlite3Driver, backend)
 	if err != nil {
 		return repo, errors.Wrap(err, "Unable to connect to the database")
 	}
 
 	if config.Migrations != "" {
-		driver, err := sqlite3.WithInstance(database, &sqlite3.Config{})
+		source, err := migrationsSource(config.Migrations, "sqlite3")
+		if err != nil {
+			return repo, err
+		}
+
+		driver, err := migratesqlite3.WithInstance(database, &migratesqlite3.Config{})
 		if err != nil {
 			return repo, errors.Wrap(err, "Could not start migration")
 		}
 
-		m, err := migrate.NewWithDatabaseInstance(
-			fmt.Sprintf("file://%s", config.Migrations),
-			"sqlite3", driver)
+		m, err := migrate.NewWithDatabaseInstance(source, "sqlite3", driver)
 
 		if err != nil {
 			return repo, errors.Wrap(err, "Migration failed")
@@ -51,6 +74,10 @@ func NewSqlite3Repo(config RepoConfig) (Repo, error) {
 			return repo, errors.Wrap(err, "Error while syncing")
 		}
 	}
+
+	// SQLite has a single writer, and shared cache connections fail rather
+	// than wait for each other's locks: transactions take turns instead
+	database.SetMaxOpenConns(1)
 	repo.db = database
 	return repo, nil
 }
@@ -58,3 +85,33 @@ func NewSqlite3Repo(config RepoConfig) (Repo, error) {
 func (repo *Sqlite3Repo) Description() string {
 	return fmt.Sprintf("sqlite3 (%s)", repo.backend)
 }
+
+func translateSqlite3Error(err error) error {
+	sqliteErr, ok := err.(sqlite3.Error)
+	if !ok {
+		return nil
+	}
+	switch {
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique,
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+		return ErrDuplicateId
+	case sqliteErr.Code == sqlite3.ErrConstraint, sqliteErr.Code == sqlite3.ErrMismatch,
+		sqliteErr.Code == sqlite3.ErrTooBig:
+		return ErrInvalid
+	case sqliteErr.Code == sqlite3.ErrBusy, sqliteErr.Code == sqlite3.ErrLocked,
+		sqliteErr.Code == sqlite3.ErrCantOpen, sqliteErr.Code == sqlite3.ErrIoErr:
+		return ErrUnavailable
+	default:
+		return nil
+	}
+}
+
+func sqlite3AttributeExpr(key string) string {
+	return fmt.Sprintf("NULLIF(json_extract(attributes, '$.%s'), '')", key)
+}
+
+// sqlite3NumericExpr converts text to a number with arithmetic, rather than
+// with a CAST, which SQLite does not match against expression indexes.
+func sqlite3NumericExpr(expr string) string {
+	return fmt.Sprintf("(%s + 0)", expr)
+}
@@ -0,0 +1,11 @@
+//go:build !cgo
+// +build !cgo
+
+package util
+
+import "fmt"
+
+// NewSqlite3Repo fails when built without cgo, which SQLite needs.
+func NewSqlite3Repo(config RepoConfig) (Repo, error) {
+	return nil, fmt.Errorf("sqlite3 repos need cgo, use a memory repo instead")
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// IdGenerator mints new unique identifiers for resources.
+type IdGenerator func() (string, error)
+
+func NewIdGenerator(uuidVersion string) (IdGenerator, error) {
+	switch uuidVersion {
+	case "v4":
+		return NewUUIDv4, nil
+	case "v7":
+		return NewUUIDv7, nil
+	default:
+		return nil, fmt.Errorf("uuid version not supported: %v", uuidVersion)
+	}
+}
+
+// NewUUIDv4 returns a random UUID, as defined in RFC 4122.
+func NewUUIDv4() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	return formatUUID(u, 4), nil
+}
+
+// NewUUIDv7 returns a time-ordered UUID, starting with the milliseconds
+// elapsed since the unix epoch, so ids sort by creation time.
+func NewUUIDv7() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		return "", err
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(u[:6], ms[2:])
+	return formatUUID(u, 7), nil
+}
+
+func formatUUID(u [16]byte, version byte) string {
+	u[6] = (u[6] & 0x0f) | version<<4
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
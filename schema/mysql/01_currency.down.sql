@@ -0,0 +1,3 @@
+UPDATE payments
+SET attributes = CONCAT('{', SUBSTR(attributes, 19))
+WHERE attributes LIKE '{"currency":"GBP",%'
@@ -0,0 +1,7 @@
+-- Payments stored before currencies were required have no currency: they
+-- are taken to be in GBP, the only currency then in use. Their amounts are
+-- left as they were stored, and returned as such until next updated, even
+-- when not in canonical form (eg. 1e3).
+UPDATE payments
+SET attributes = CONCAT('{"currency":"GBP",', SUBSTR(attributes, 2))
+WHERE attributes LIKE '{"%' AND attributes NOT LIKE '%"currency":%'
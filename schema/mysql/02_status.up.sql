@@ -0,0 +1 @@
+ALTER TABLE payments ADD COLUMN status VARCHAR(32) NOT NULL DEFAULT 'created'
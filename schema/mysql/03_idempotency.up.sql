@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS payments_idempotency(
+    idempotency_key VARCHAR(255) NOT NULL,
+    organisation VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    body MEDIUMTEXT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    PRIMARY KEY (idempotency_key, organisation)
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin
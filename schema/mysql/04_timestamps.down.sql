@@ -0,0 +1,4 @@
+ALTER TABLE payments
+    DROP COLUMN created_at,
+    DROP COLUMN updated_at,
+    DROP COLUMN deleted_at
@@ -0,0 +1,4 @@
+ALTER TABLE payments
+    ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN deleted_at BIGINT NOT NULL DEFAULT 0
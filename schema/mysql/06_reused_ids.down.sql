@@ -0,0 +1,3 @@
+ALTER TABLE payments_versions
+    DROP INDEX payments_versions_id,
+    ADD PRIMARY KEY (id, version, operation)
@@ -0,0 +1,3 @@
+ALTER TABLE payments_versions
+    DROP PRIMARY KEY,
+    ADD INDEX payments_versions_id (id, version)
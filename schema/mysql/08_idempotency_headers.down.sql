@@ -0,0 +1 @@
+ALTER TABLE payments_idempotency DROP COLUMN headers
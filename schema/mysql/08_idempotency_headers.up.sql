@@ -0,0 +1 @@
+ALTER TABLE payments_idempotency ADD COLUMN headers VARCHAR(4096) NOT NULL DEFAULT ''
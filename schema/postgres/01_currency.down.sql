@@ -0,0 +1,6 @@
+-- By the time this runs, attributes are text again, as 07 leaves them when
+-- rolled back, but their members are no longer in the order nor the format
+-- they were stored in: currencies are removed as JSON, rather than as text.
+UPDATE payments
+SET attributes = (attributes::jsonb - 'currency')::text
+WHERE attributes::jsonb ->> 'currency' = 'GBP'
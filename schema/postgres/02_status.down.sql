@@ -0,0 +1 @@
+ALTER TABLE payments DROP COLUMN status
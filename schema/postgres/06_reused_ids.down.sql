@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS payments_versions_id;
+ALTER TABLE payments_versions ADD PRIMARY KEY (id, version, operation)
@@ -0,0 +1,2 @@
+ALTER TABLE payments_versions DROP CONSTRAINT payments_versions_pkey;
+CREATE INDEX payments_versions_id ON payments_versions (id, version)
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS payments_attributes;
+ALTER TABLE payments ALTER COLUMN attributes TYPE TEXT USING attributes::text;
+ALTER TABLE payments_versions ALTER COLUMN attributes TYPE TEXT USING attributes::text;
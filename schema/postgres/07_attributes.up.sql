@@ -0,0 +1,3 @@
+ALTER TABLE payments ALTER COLUMN attributes TYPE JSONB USING attributes::jsonb;
+ALTER TABLE payments_versions ALTER COLUMN attributes TYPE JSONB USING attributes::jsonb;
+CREATE INDEX IF NOT EXISTS payments_attributes ON payments USING GIN (attributes jsonb_path_ops);
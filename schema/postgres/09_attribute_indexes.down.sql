@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS payments_reference;
+DROP INDEX IF EXISTS payments_processing_date_sort;
+DROP INDEX IF EXISTS payments_reference_sort;
+DROP INDEX IF EXISTS payments_currency_sort;
+DROP INDEX IF EXISTS payments_amount_sort;
+DROP INDEX IF EXISTS payments_amount
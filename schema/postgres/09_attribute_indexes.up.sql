@@ -0,0 +1,20 @@
+-- These expressions are the ones the postgres repo filters and sorts by, and
+-- must be kept in sync with it. Amounts are indexed as numbers, when they
+-- are: those stored before being validated may not be (eg. Inf, 0x1p4), and
+-- are indexed as missing rather than failing the cast.
+CREATE INDEX IF NOT EXISTS payments_amount ON payments ((CAST(CASE WHEN attributes ->> 'amount' ~ '^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]{1,3})?$' THEN attributes ->> 'amount' END AS NUMERIC)));
+CREATE INDEX IF NOT EXISTS payments_amount_sort ON payments ((CAST(COALESCE(CASE WHEN attributes ->> 'amount' ~ '^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]{1,3})?$' THEN attributes ->> 'amount' END, '0') AS NUMERIC)), id);
+CREATE INDEX IF NOT EXISTS payments_currency_sort ON payments ((COALESCE(NULLIF(attributes ->> 'currency', ''), '')), id);
+CREATE INDEX IF NOT EXISTS payments_reference_sort ON payments ((COALESCE(NULLIF(attributes ->> 'reference', ''), '')), id);
+CREATE INDEX IF NOT EXISTS payments_processing_date_sort ON payments ((COALESCE(NULLIF(attributes ->> 'processing_date', ''), '')), id);
+-- Reference searches match substrings, which only trigram indexes support.
+-- Without the pg_trgm extension, or the privilege to create it, they are
+-- left unindexed.
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS pg_trgm;
+    CREATE INDEX IF NOT EXISTS payments_reference ON payments USING GIN ((LOWER(NULLIF(attributes ->> 'reference', ''))) gin_trgm_ops);
+EXCEPTION WHEN insufficient_privilege OR undefined_file OR feature_not_supported THEN
+    RAISE NOTICE 'pg_trgm is not available: reference searches are not indexed';
+END
+$$
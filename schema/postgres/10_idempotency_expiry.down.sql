@@ -0,0 +1 @@
+UPDATE payments_idempotency SET expires_at = expires_at / 1000;
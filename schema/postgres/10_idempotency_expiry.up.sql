@@ -0,0 +1,3 @@
+-- Idempotency records used to expire at a time in seconds, unlike every
+-- other timestamp of the repo, which are in milliseconds.
+UPDATE payments_idempotency SET expires_at = expires_at * 1000;
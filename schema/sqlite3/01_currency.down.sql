@@ -0,0 +1,3 @@
+UPDATE payments
+SET attributes = '{' || substr(attributes, 19)
+WHERE attributes LIKE '{"currency":"GBP",%'
@@ -0,0 +1,11 @@
+CREATE TABLE payments_down(
+    id VARCHAR(255) PRIMARY KEY NOT NULL,
+    version INT NOT NULL DEFAULT 0,
+    organisation VARCHAR(255) NOT NULL,
+    deleted INT DEFAULT 0,
+    attributes TEXT NOT NULL
+);
+INSERT INTO payments_down (id, version, organisation, deleted, attributes)
+    SELECT id, version, organisation, deleted, attributes FROM payments;
+DROP TABLE payments;
+ALTER TABLE payments_down RENAME TO payments;
@@ -0,0 +1,12 @@
+CREATE TABLE payments_down(
+    id VARCHAR(255) PRIMARY KEY NOT NULL,
+    version INT NOT NULL DEFAULT 0,
+    organisation VARCHAR(255) NOT NULL,
+    deleted INT DEFAULT 0,
+    attributes TEXT NOT NULL,
+    status VARCHAR(32) NOT NULL DEFAULT 'created'
+);
+INSERT INTO payments_down (id, version, organisation, deleted, attributes, status)
+    SELECT id, version, organisation, deleted, attributes, status FROM payments;
+DROP TABLE payments;
+ALTER TABLE payments_down RENAME TO payments;
@@ -0,0 +1,3 @@
+ALTER TABLE payments ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN deleted_at BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS payments_versions(
+    id VARCHAR(255) NOT NULL,
+    version INT NOT NULL,
+    operation VARCHAR(16) NOT NULL,
+    organisation VARCHAR(255) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    attributes TEXT NOT NULL,
+    created_at BIGINT NOT NULL DEFAULT 0,
+    updated_at BIGINT NOT NULL DEFAULT 0,
+    deleted_at BIGINT NOT NULL DEFAULT 0,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    request_id VARCHAR(255) NOT NULL DEFAULT '',
+    recorded_at BIGINT NOT NULL,
+    PRIMARY KEY (id, version, operation)
+);
+
+-- Payments stored before their history was recorded start it with a
+-- snapshot of how they are now, recorded by this migration.
+INSERT INTO payments_versions (id, version, operation, organisation, status, attributes, created_at, updated_at, deleted_at, recorded_at)
+SELECT id, version,
+    CASE WHEN deleted = 1 THEN 'delete' WHEN version = 0 THEN 'create' ELSE 'update' END,
+    organisation, status, attributes, created_at, updated_at, deleted_at, CAST(strftime('%s', 'now') AS INTEGER) * 1000
+FROM payments;
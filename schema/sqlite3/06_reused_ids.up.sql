@@ -0,0 +1,18 @@
+CREATE TABLE payments_versions_up(
+    id VARCHAR(255) NOT NULL,
+    version INT NOT NULL,
+    operation VARCHAR(16) NOT NULL,
+    organisation VARCHAR(255) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    attributes TEXT NOT NULL,
+    created_at BIGINT NOT NULL DEFAULT 0,
+    updated_at BIGINT NOT NULL DEFAULT 0,
+    deleted_at BIGINT NOT NULL DEFAULT 0,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    request_id VARCHAR(255) NOT NULL DEFAULT '',
+    recorded_at BIGINT NOT NULL
+);
+INSERT INTO payments_versions_up SELECT id, version, operation, organisation, status, attributes, created_at, updated_at, deleted_at, actor, request_id, recorded_at FROM payments_versions;
+DROP TABLE payments_versions;
+ALTER TABLE payments_versions_up RENAME TO payments_versions;
+CREATE INDEX payments_versions_id ON payments_versions (id, version);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS payments_currency;
+DROP INDEX IF EXISTS payments_amount;
@@ -0,0 +1,5 @@
+-- json_extract comes with the JSON1 extension of SQLite, or is registered by
+-- the repo when SQLite is built without it: these indexes can only be kept
+-- up to date by connections defining it.
+CREATE INDEX IF NOT EXISTS payments_currency ON payments (NULLIF(json_extract(attributes, '$.currency'), ''));
+CREATE INDEX IF NOT EXISTS payments_amount ON payments ((NULLIF(json_extract(attributes, '$.amount'), '') + 0));
@@ -0,0 +1,13 @@
+CREATE TABLE payments_idempotency_down(
+    idempotency_key VARCHAR(255) NOT NULL,
+    organisation VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    PRIMARY KEY (idempotency_key, organisation)
+);
+INSERT INTO payments_idempotency_down SELECT idempotency_key, organisation, request_hash, status_code, content_type, body, expires_at FROM payments_idempotency;
+DROP TABLE payments_idempotency;
+ALTER TABLE payments_idempotency_down RENAME TO payments_idempotency
@@ -0,0 +1,135 @@
+Feature: Deleted payments
+  In order to recover from mistakes and comply with retention policies
+  As an administrator
+  I need to restore or purge deleted payments
+
+  Scenario: Listing deleted payments
+    Given I created a new payment with id abc
+    And I created a new payment with id def
+    And I deleted that payment
+    When I get the deleted payments
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to def
+    And that json should have a data[0].deleted_at
+
+  Scenario: Filtering deleted payments
+    Given a payment with id abc and amount 10.00 GBP
+    And I created that payment
+    And I deleted that payment
+    And a payment with id def and amount 10.00 EUR
+    And I created that payment
+    And I deleted that payment
+    When I get the deleted payments with currency=EUR
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to def
+
+  Scenario: Paginating deleted payments
+    Given I created a new payment with id abc
+    And I deleted that payment
+    And I created a new payment with id def
+    And I deleted that payment
+    And I created a new payment with id ghi
+    When I get the deleted payments with from=0&to=1&sort=-id
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to def
+    And that json should have int at meta.total equal to 2
+    And that json should have string at links.self equal to http://localhost:8080/admin/payments/deleted?from=0&to=1&sort=-id
+    And that json should have string at links.next equal to http://localhost:8080/admin/payments/deleted?from=1&to=2&sort=-id
+    And I follow the next link
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to abc
+    And that json should not have a links.next
+
+  Scenario: Paginating deleted payments with cursors
+    Given I created a new payment with id abc
+    And I deleted that payment
+    And I created a new payment with id def
+    And I deleted that payment
+    And I created a new payment with id ghi
+    When I get the deleted payments with limit=1
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data[0].id equal to abc
+    And that json should have string at links.first equal to http://localhost:8080/admin/payments/deleted?limit=1
+    And I follow the next link
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to def
+    And that json should not have a links.next
+    And I follow the prev link
+    And I should have a json
+    And that json should have string at data[0].id equal to abc
+
+  Scenario: Undeleting a payment
+    Given I created a new payment with id abc
+    And I deleted that payment
+    When I undelete that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at data.version equal to 2
+    And that json should not have a data.deleted_at
+    And I get that payment
+    And I should have status code 200
+    And I get the versions of that payment
+    And I should have a json
+    And that json should have string at data[2].operation equal to undelete
+
+  Scenario: Undeleting a live payment
+    Given I created a new payment with id abc
+    When I undelete that payment
+    Then I should have status code 404
+
+  Scenario: Purging deleted payments
+    Given I created a new payment with id abc
+    And I deleted that payment
+    And I created a new payment with id def
+    When I purge payments deleted more than 0s ago
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at purged equal to 1
+    And I get the deleted payments
+    And I should have a json
+    And that json should have 0 items
+    And I get payments with from=0&to=10
+    And I should have a json
+    And that json should have 1 items
+
+  Scenario: Purging the history of deleted payments
+    Given a payment with id abc
+    And that payment has reference ref1
+    And I created that payment
+    And I deleted that payment
+    And I purge payments deleted more than 0s ago
+    And a payment with id abc
+    And that payment belongs to organisation org2
+    When I create that payment
+    Then I should have status code 201
+    And I get the versions of that payment
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].operation equal to create
+    And that json should have string at data[0].payment.organisation_id equal to org2
+    And that json should not have a data[0].payment.attributes.reference
+    And I get version 1 of that payment
+    And I should have status code 404
+
+  Scenario: Keeping recently deleted payments
+    Given I created a new payment with id abc
+    And I deleted that payment
+    When I purge payments deleted more than 24h ago
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at purged equal to 0
+
+  Scenario: Invalid retention
+    When I purge payments deleted more than a-while ago
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].parameter equal to older_than
@@ -0,0 +1,130 @@
+Feature: Batch payment creation
+  In order to import payments from other systems
+  As an api client
+  I need to create many payments with a single request
+
+  Scenario: Atomic batch
+    Given a batch of payments with ids abc,def,ghi
+    When I create that batch
+    Then I should have status code 201
+    And I should have a json
+    And that json should have 3 items
+    And that json should have string at meta.mode equal to atomic
+    And that json should have int at meta.created equal to 3
+    And that json should have int at meta.failed equal to 0
+    And that json should have int at data[0].status equal to 201
+    And that json should have string at data[0].id equal to abc
+    And that json should have int at data[0].data.version equal to 0
+    And that json should have a data[0].data.created_at
+    And that json should have a data[0].links.self
+    And that json should have string at data[2].data.id equal to ghi
+    And I should have 3 payment(s)
+
+  Scenario: Batch without ids
+    Given a batch of 2 payments without id
+    When I create that batch
+    Then I should have status code 201
+    And I should have a json
+    And that json should have a data[0].data.id
+    And that json should have a data[1].data.id
+    And I should have 2 payment(s)
+
+  Scenario: Batch history
+    Given a batch of payments with ids abc,def
+    And I use header X-Actor equal to alice
+    When I create that batch
+    And I get the versions of that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].operation equal to create
+    And that json should have string at data[0].actor equal to alice
+
+  Scenario: Atomic batch with an existing payment
+    Given I created a new payment with id def
+    And a batch of payments with ids abc,def
+    When I create that batch
+    Then I should have status code 409
+    And I should have a json
+    And that json should have int at meta.created equal to 0
+    And that json should have int at meta.failed equal to 2
+    And that json should have int at data[0].status equal to 424
+    And that json should have int at data[1].status equal to 409
+    And that json should have string at data[1].error.detail equal to duplicate id
+    And I should have 1 payment(s)
+
+  Scenario: Atomic batch with a deleted payment
+    Given I created a new payment with id def
+    And I deleted that payment
+    And a batch of payments with ids abc,def
+    When I create that batch
+    Then I should have status code 410
+    And I should have a json
+    And that json should have int at data[0].status equal to 424
+    And that json should have int at data[1].status equal to 410
+    And I should have 0 payment(s)
+
+  Scenario: Atomic batch with an invalid payment
+    Given a batch of payments with ids abc
+    And that batch has a payment without organisation, and id def
+    When I create that batch
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].pointer equal to /data/1/organisation_id
+    And I should have 0 payment(s)
+
+  Scenario: Atomic batch with the same id twice
+    Given a batch of payments with ids abc,abc
+    When I create that batch
+    Then I should have status code 409
+    And I should have a json
+    And that json should have int at data[0].status equal to 424
+    And that json should have int at data[1].status equal to 409
+    And I should have 0 payment(s)
+
+  Scenario: Partial batch
+    Given I created a new payment with id def
+    And a batch of payments with ids abc,def
+    And that batch has a payment without organisation, and id ghi
+    When I create that batch in partial mode
+    Then I should have status code 207
+    And I should have a json
+    And that json should have string at meta.mode equal to partial
+    And that json should have int at meta.created equal to 1
+    And that json should have int at meta.failed equal to 2
+    And that json should have int at data[0].status equal to 201
+    And that json should have int at data[1].status equal to 409
+    And that json should have int at data[2].status equal to 400
+    And that json should have string at data[2].error.errors[0].pointer equal to /data/2/organisation_id
+    And I should have 2 payment(s)
+
+  Scenario: Partial batch without failures
+    Given a batch of payments with ids abc,def
+    When I create that batch in partial mode
+    Then I should have status code 201
+    And I should have 2 payment(s)
+
+  Scenario: Unknown batch mode
+    Given a batch of payments with ids abc
+    When I create that batch in eventual mode
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].parameter equal to mode
+    And I should have 0 payment(s)
+
+  Scenario: Too many payments
+    Given a batch of 101 payments without id
+    When I create that batch
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].code equal to too_many
+    And I should have 0 payment(s)
+
+  Scenario: Retrying a batch
+    Given I use idempotency key key1
+    And a batch of payments with ids abc,def
+    And I create that batch
+    When I create that batch
+    Then I should have status code 201
+    And I should have header Idempotent-Replayed equal to true
+    And I should have 2 payment(s)
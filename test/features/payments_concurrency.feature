@@ -0,0 +1,63 @@
+Feature: Conditional requests on payments
+  In order to avoid overwriting changes made by others
+  As an api client
+  I need payments to have an ETag I can make my requests conditional on
+
+  Scenario: Getting a payment returns its ETag
+    Given I created a new payment with id abc
+    When I get that payment
+    Then I should have status code 200
+    And I should have header ETag equal to "0"
+
+  Scenario: Getting an unchanged payment
+    Given I created a new payment with id abc
+    And I use header If-None-Match equal to "0"
+    When I get that payment
+    Then I should have status code 304
+    And I should have header ETag equal to "0"
+
+  Scenario: Getting a changed payment
+    Given I created a new payment with id abc
+    And I updated that payment
+    And I use header If-None-Match equal to "0"
+    When I get that payment
+    Then I should have status code 200
+    And I should have header ETag equal to "1"
+
+  Scenario: Updating a payment with a matching ETag
+    Given I created a new payment with id abc
+    And I use header If-Match equal to "0"
+    When I update version 5 of that payment
+    Then I should have status code 200
+    And I should have header ETag equal to "1"
+    And I should have a json
+    And that json should have int at data.version equal to 1
+
+  Scenario: Updating a payment with a stale ETag
+    Given I created a new payment with id abc
+    And I updated that payment
+    And I use header If-Match equal to "0"
+    When I update that payment
+    Then I should have status code 412
+    And I should have a problem
+
+  Scenario: Deleting a payment with a matching ETag
+    Given I created a new payment with id abc
+    And I use header If-Match equal to "0"
+    When I delete that payment, without saying which version
+    Then I should have status code 204
+    And I should have 0 payment(s)
+
+  Scenario: Deleting a payment with a stale ETag
+    Given I created a new payment with id abc
+    And I updated that payment
+    And I use header If-Match equal to "0"
+    When I delete that payment, without saying which version
+    Then I should have status code 412
+    And I should have 1 payment(s)
+
+  Scenario: Deleting a payment with any ETag
+    Given I created a new payment with id abc
+    And I use header If-Match equal to *
+    When I delete that payment, without saying which version
+    Then I should have status code 204
@@ -39,3 +39,130 @@ Feature: Create payments
     When I create that payment
     Then I should have status code 400
     And I should have 0 payment(s)
+
+  Scenario: Invalid payments are described as problems
+    Given a payment without organisation, and id abc
+    When I create that payment
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have int at status equal to 400
+    And that json should have string at instance equal to /v1/payments
+    And that json should have a request_id
+    And that json should have string at errors[0].pointer equal to /data/organisation_id
+
+  Scenario: Every validation problem is reported at once
+    Given a payment without organisation, and id abc and amount -5.00
+    When I create that payment
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have 2 items at errors
+    And that json should have string at errors[0].pointer equal to /data/organisation_id
+    And that json should have string at errors[0].code equal to required
+    And that json should have string at errors[1].pointer equal to /data/attributes/amount
+    And that json should have string at errors[1].code equal to not_positive
+
+  Scenario: Amounts are stored in their canonical form
+    Given a payment with id abc and amount 5 GBP
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.amount equal to 5.00
+    And that json should have string at data.attributes.currency equal to GBP
+
+  Scenario: Amounts follow the currency minor units
+    Given a payment with id abc and amount 1.500 BHD
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.attributes.amount equal to 1.500
+
+  Scenario: Amounts with more decimals than the currency allows
+    Given a payment with id abc and amount 100.5 JPY
+    When I create that payment
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].code equal to too_precise
+    And I should have 0 payment(s)
+
+  Scenario: Amounts in exponent notation
+    Given a payment with id abc and amount 1e3 GBP
+    When I create that payment
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].code equal to invalid
+
+  Scenario: Invalid amount and unknown currency
+    Given a payment with id abc and amount 1e3 XYZ
+    When I create that payment
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].pointer equal to /data/attributes/amount
+    And that json should have string at errors[0].code equal to invalid
+    And that json should have string at errors[1].pointer equal to /data/attributes/currency
+    And that json should have string at errors[1].code equal to unknown_currency
+
+  Scenario: Unknown currency
+    Given a payment with id abc and amount 10.00 XYZ
+    When I create that payment
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].pointer equal to /data/attributes/currency
+    And that json should have string at errors[0].code equal to unknown_currency
+
+  Scenario: Complete payment
+    Given a complete payment with id abc
+    When I create that payment
+    Then I should have status code 201
+    And I get that payment
+    And I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.beneficiary_party.account_number equal to 31926819
+    And that json should have string at data.attributes.debtor_party.account_number_code equal to IBAN
+    And that json should have string at data.attributes.sponsor_party.bank_id equal to 123123
+    And that json should have string at data.attributes.charges_information.sender_charges[0].amount equal to 5.00
+    And that json should have string at data.attributes.fx.original_currency equal to USD
+    And that json should have string at data.attributes.processing_date equal to 2017-01-18
+    And that json should have string at data.attributes.scheme_payment_type equal to ImmediatePayment
+
+  Scenario: Payment with invalid details
+    Given a payment with id abc and invalid details
+    When I create that payment
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have 3 items at errors
+    And that json should have string at errors[0].pointer equal to /data/attributes/beneficiary_party/bank_id
+    And that json should have string at errors[1].pointer equal to /data/attributes/charges_information/sender_charges/0/amount
+    And that json should have string at errors[2].pointer equal to /data/attributes/processing_date
+
+  Scenario: Payment without an id
+    Given a payment without id
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have a data.id
+    And I follow the location header
+    And I should have status code 200
+    And I should have 1 payment(s)
+
+  Scenario: Location of a new payment
+    Given a payment with id abc
+    When I create that payment
+    Then I should have status code 201
+    And I should have header Location equal to http://localhost:8080/v1/payments/abc
+
+  Scenario: Id of a deleted payment
+    Given I created a new payment with id abc
+    And I deleted that payment
+    When I create that payment
+    Then I should have status code 410
+    And I should have a problem
+
+  Scenario: Id of a purged payment
+    Given I created a new payment with id abc
+    And I deleted that payment
+    And I purge payments deleted more than 0s ago
+    When I create that payment
+    Then I should have status code 201
+    And I get the versions of that payment
+    And I should have a json
+    And that json should have 1 items
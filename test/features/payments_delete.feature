@@ -18,7 +18,7 @@ Feature: Delete payments
     Given I created a new payment with id abc
     And I deleted that payment
     When I delete that payment
-    Then I should have status code 404
+    Then I should have status code 410
 
   Scenario: Obsolete version
     Given I created a new payment with id abc
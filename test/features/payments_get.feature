@@ -17,4 +17,13 @@ Feature: Get a payment
     Given I created a new payment with id abc
     And I deleted that payment
     When I get that payment
+    Then I should have status code 410
+
+  Scenario: Missing payments are described as problems
+    Given a payment with id abc
+    When I get that payment
     Then I should have status code 404
+    And I should have a problem
+    And that json should have int at status equal to 404
+    And that json should have string at title equal to Not Found
+    And that json should have string at instance equal to /v1/payments/abc
@@ -0,0 +1,73 @@
+Feature: Idempotent requests
+  In order to safely retry requests after a timeout
+  As an api client
+  I need requests sent with the same Idempotency-Key to be processed only once
+
+  Scenario: Retrying a payment creation
+    Given I use idempotency key key1
+    And I created a new payment with id abc
+    When I create that payment
+    Then I should have status code 201
+    And I should have header Idempotent-Replayed equal to true
+    And I should have a json
+    And that json should have string at data.id equal to abc
+    And I should have 1 payment(s)
+
+  Scenario: Reusing a key for a different payment
+    Given I use idempotency key key1
+    And I created a new payment with id abc
+    And a payment with id def
+    When I create that payment
+    Then I should have status code 422
+    And I should have a problem
+    And I should have 1 payment(s)
+
+  Scenario: Retrying a payment creation without a key
+    Given I created a new payment with id abc
+    When I create that payment
+    Then I should have status code 409
+
+  Scenario: Retrying a payment transition
+    Given I created a new payment with id abc
+    And I use idempotency key key2
+    And I performed request-approval on that payment
+    When I perform request-approval on that payment
+    Then I should have status code 200
+    And I should have header Idempotent-Replayed equal to true
+    And I should have a json
+    And that json should have string at data.status equal to pending_approval
+    And that json should have int at data.version equal to 1
+
+  Scenario: Failed requests are replayed too
+    Given I use idempotency key key3
+    And a payment with id abc and amount -1.00
+    And I create that payment
+    And I should have status code 400
+    When I create that payment
+    Then I should have status code 400
+    And I should have header Idempotent-Replayed equal to true
+
+  Scenario: Retrying the creation of a payment without an id
+    Given I use idempotency key key4
+    And a payment without id
+    And I create that payment
+    And I should have status code 201
+    When I create that payment
+    Then I should have status code 201
+    And I should have header Idempotent-Replayed equal to true
+    And I should have 1 payment(s)
+
+  Scenario: Retrying a payment creation replays its location and ETag
+    Given I use idempotency key key5
+    And a payment without id
+    And I create that payment
+    And I should have status code 201
+    When I create that payment
+    Then I should have status code 201
+    And I should have header Idempotent-Replayed equal to true
+    And I should have header ETag equal to "0"
+    And I should have a json
+    And I should have the location of the payment in that json
+    And I follow the location header
+    And I should have status code 200
+    And I should have 1 payment(s)
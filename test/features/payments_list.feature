@@ -29,7 +29,8 @@ Feature: List payments
     And that json should have a data[0].attributes.amount
     And that json should have a links
     And that json should have a links.self
-    And that json should have a links.next
+    And that json should not have a links.next
+    And that json should not have a links.prev
 
   Scenario: Prev link
     When I get payments 20 to 40
@@ -38,7 +39,83 @@ Feature: List payments
     And that json should have a links
     And that json should have a links.prev
     And that json should have a links.self
-    And that json should have a links.next
+    And that json should not have a links.next
+
+  Scenario: Next link
+    Given I created 30 payments
+    When I get payments 0 to 20
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at links.next equal to http://localhost:8080/v1/payments?from=20&to=40
+    And I follow the next link
+    And I should have a json
+    And that json should have 10 items
+    And that json should not have a links.next
+    And that json should have string at links.prev equal to http://localhost:8080/v1/payments?from=0&to=20
+
+  Scenario: Payments are listed by id
+    Given I created a new payment with id def
+    And I created a new payment with id abc
+    When I get all payments
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data[0].id equal to abc
+    And that json should have string at data[1].id equal to def
+
+  Scenario: Paginating with a cursor
+    Given I created 5 payments
+    When I get payments with limit=2
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 2 items
+    And that json should have string at data[0].id equal to payment0
+    And that json should not have a links.prev
+    And I follow the next link
+    And I should have a json
+    And that json should have string at data[0].id equal to payment2
+    And that json should have string at data[1].id equal to payment3
+    And that json should have a links.prev
+    And I follow the next link
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to payment4
+    And that json should not have a links.next
+    And I follow the prev link
+    And I should have a json
+    And that json should have string at data[0].id equal to payment2
+    And that json should have string at data[1].id equal to payment3
+    And I follow the prev link
+    And I should have a json
+    And that json should have string at data[0].id equal to payment0
+    And that json should have string at data[1].id equal to payment1
+    And that json should not have a links.prev
+
+  Scenario: Cursors are not affected by new payments
+    Given I created 4 payments
+    And I get payments with limit=2
+    And I should have a json
+    And I created a new payment with id abc
+    When I follow the next link
+    Then I should have a json
+    And that json should have string at data[0].id equal to payment2
+
+  Scenario: Paginating with a cursor and filters
+    Given I created 3 payments
+    And a payment with id abc and amount 10.00 EUR
+    And I created that payment
+    When I get payments with currency=GBP&limit=2
+    Then I should have status code 200
+    And I should have a json
+    And I follow the next link
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to payment2
+
+  Scenario: Invalid cursor
+    When I get payments with cursor=abc&from=2
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have 2 items at errors
 
   Scenario: Default results page
     Given I created 100 payments
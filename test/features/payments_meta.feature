@@ -0,0 +1,73 @@
+Feature: Payments metadata
+  In order to show how many pages of payments there are
+  As a product owner
+  I need payment listings to tell how many payments match
+
+  Background:
+    Given a payment with id abc and amount 10.00 GBP
+    And I created that payment
+    And a payment with id def and amount 20.00 GBP
+    And I created that payment
+    And a payment with id ghi and amount 30.00 GBP
+    And I created that payment
+    And a payment with id jkl and amount 40.00 EUR
+    And I created that payment
+    And a payment with id mno and amount 50.00 GBP
+    And I created that payment
+
+  Scenario: Counting payments
+    When I get payments with from=0&to=2
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at meta.total equal to 5
+    And that json should have int at meta.limit equal to 2
+    And that json should have bool at meta.has_more equal to true
+    And that json should have string at links.first equal to http://localhost:8080/v1/payments?from=0&to=2
+    And that json should have string at links.last equal to http://localhost:8080/v1/payments?from=4&to=6
+
+  Scenario: Counting filtered payments
+    When I get payments with currency=GBP&from=0&to=2
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at meta.total equal to 4
+    And that json should have string at links.last equal to http://localhost:8080/v1/payments?from=2&to=4&currency=GBP
+    And I follow the last link
+    And I should have a json
+    And that json should have 2 items
+    And that json should have bool at meta.has_more equal to false
+
+  Scenario: Not counting payments
+    When I get payments with count=false&from=2&to=4
+    Then I should have status code 200
+    And I should have a json
+    And that json should not have a meta.total
+    And that json should not have a links.last
+    And that json should have bool at meta.has_more equal to true
+    And that json should have string at links.next equal to http://localhost:8080/v1/payments?from=4&to=6&count=false
+
+  Scenario: Last page with a cursor
+    When I get payments with limit=2&count=false
+    Then I should have status code 200
+    And I should have a json
+    And that json should not have a meta.total
+    And I follow the last link
+    And I should have a json
+    And that json should have 2 items
+    And that json should have string at data[0].id equal to jkl
+    And that json should have string at data[1].id equal to mno
+    And that json should have bool at meta.has_more equal to false
+    And that json should not have a links.next
+    And I follow the prev link
+    And I should have a json
+    And that json should have 2 items
+    And that json should have string at data[0].id equal to def
+    And that json should have string at data[1].id equal to ghi
+    And I follow the first link
+    And I should have a json
+    And that json should have string at data[0].id equal to abc
+
+  Scenario: Invalid count
+    When I get payments with count=maybe
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].parameter equal to count
@@ -0,0 +1,108 @@
+Feature: Patch payments
+  In order to change a few fields of a payment
+  As an api client
+  I need to send partial updates instead of the whole payment
+
+  Scenario: Non existing payment
+    Given a payment with id abc
+    When I patch that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    Then I should have status code 404
+
+  Scenario: Merge patch
+    Given I created a new payment with id abc
+    When I patch that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    Then I should have status code 200
+    And I should have header ETag equal to "1"
+    And I should have a json
+    And that json should have string at data.attributes.reference equal to ref1
+    And that json should have string at data.attributes.amount equal to 1.00
+    And that json should have int at data.version equal to 1
+
+  Scenario: Merge patch removing a field
+    Given I created a new payment with id abc
+    And I patched that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    When I patch that payment as application/merge-patch+json with {"data":{"attributes":{"reference":null}}}
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at data.version equal to 2
+
+  Scenario: Json patch
+    Given I created a new payment with id abc
+    When I patch that payment as application/json-patch+json with [{"op":"test","path":"/data/version","value":0},{"op":"replace","path":"/data/attributes/amount","value":"2.50"}]
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.attributes.amount equal to 2.50
+    And that json should have int at data.version equal to 1
+
+  Scenario: Json patch with a failed test
+    Given I created a new payment with id abc
+    And I updated that payment
+    When I patch that payment as application/json-patch+json with [{"op":"test","path":"/data/version","value":0},{"op":"replace","path":"/data/attributes/amount","value":"2.50"}]
+    Then I should have status code 409
+    And I should have a problem
+
+  Scenario: Json patch on a missing path
+    Given I created a new payment with id abc
+    When I patch that payment as application/json-patch+json with [{"op":"replace","path":"/data/attributes/unknown/field","value":"x"}]
+    Then I should have status code 400
+    And I should have a problem
+
+  Scenario: Patch resulting in an invalid payment
+    Given I created a new payment with id abc
+    When I patch that payment as application/merge-patch+json with {"data":{"attributes":{"amount":"-1","currency":"XYZ"}}}
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have 2 items at errors
+
+  Scenario: Patch changing the payment id
+    Given I created a new payment with id abc
+    When I patch that payment as application/merge-patch+json with {"data":{"id":"def"}}
+    Then I should have status code 400
+    And I should have a problem
+
+  Scenario: Patch changing the payment status
+    Given I created a new payment with id abc
+    When I patch that payment as application/merge-patch+json with {"data":{"status":"approved"}}
+    Then I should have status code 422
+    And I should have a problem
+    And that json should have 1 items at errors
+    And that json should have string at errors[0].pointer equal to /data/status
+    And that json should have string at errors[0].code equal to read_only
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.status equal to created
+
+  Scenario: Json patch changing read-only fields
+    Given I created a new payment with id abc
+    When I patch that payment as application/json-patch+json with [{"op":"replace","path":"/data/version","value":3},{"op":"remove","path":"/data/updated_at"}]
+    Then I should have status code 422
+    And I should have a problem
+    And that json should have 2 items at errors
+    And that json should have string at errors[0].pointer equal to /data/version
+    And that json should have string at errors[1].pointer equal to /data/updated_at
+
+  Scenario: Patch moving the payment to another organisation
+    Given I created a new payment with id abc
+    When I patch that payment as application/merge-patch+json with {"data":{"organisation_id":"org2"}}
+    Then I should have status code 422
+    And I should have a problem
+    And that json should have 1 items at errors
+    And that json should have string at errors[0].pointer equal to /data/organisation_id
+    And that json should have string at errors[0].code equal to read_only
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.organisation_id equal to org1
+    And that json should have int at data.version equal to 0
+
+  Scenario: Patch with a stale ETag
+    Given I created a new payment with id abc
+    And I updated that payment
+    And I use header If-Match equal to "0"
+    When I patch that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    Then I should have status code 412
+
+  Scenario: Patch with an unsupported content type
+    Given I created a new payment with id abc
+    When I patch that payment as application/json with {"data":{"attributes":{"reference":"ref1"}}}
+    Then I should have status code 415
+    And I should have a problem
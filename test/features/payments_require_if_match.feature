@@ -0,0 +1,54 @@
+@require-if-match
+Feature: Require conditional writes
+  In order to never overwrite changes I have not seen
+  As an api client
+  I need updates and deletes without If-Match to be refused
+
+  Scenario: Creating a payment without If-Match
+    Given a payment with id abc
+    When I create that payment
+    Then I should have status code 201
+
+  Scenario: Updating a payment without If-Match
+    Given I created a new payment with id abc
+    When I update that payment
+    Then I should have status code 428
+    And I should have a problem
+    And I get that payment
+    And I should have header ETag equal to "0"
+
+  Scenario: Patching a payment without If-Match
+    Given I created a new payment with id abc
+    When I patch that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    Then I should have status code 428
+    And I should have a problem
+    And I get that payment
+    And I should have header ETag equal to "0"
+
+  Scenario: Deleting a payment without If-Match
+    Given I created a new payment with id abc
+    When I delete that payment
+    Then I should have status code 428
+    And I should have a problem
+    And I should have 1 payment(s)
+
+  Scenario: Updating a payment with If-Match
+    Given I created a new payment with id abc
+    And I use header If-Match equal to "0"
+    When I update that payment
+    Then I should have status code 200
+    And I should have header ETag equal to "1"
+
+  Scenario: Patching a payment with If-Match
+    Given I created a new payment with id abc
+    And I use header If-Match equal to "0"
+    When I patch that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    Then I should have status code 200
+    And I should have header ETag equal to "1"
+
+  Scenario: Deleting a payment with If-Match
+    Given I created a new payment with id abc
+    And I use header If-Match equal to *
+    When I delete that payment, without saying which version
+    Then I should have status code 204
+    And I should have 0 payment(s)
@@ -0,0 +1,93 @@
+@reuse-deleted-ids
+Feature: Reuse the ids of deleted payments
+  In order to create payments again under the ids of deleted ones
+  As an api client
+  I need deleted payments to be replaced, without showing anything of them
+
+  Scenario: Deleted payment
+    Given I created a new payment with id abc
+    And I deleted that payment
+    When I get that payment
+    Then I should have status code 404
+    And I should have a problem
+
+  Scenario: Creating a payment over a deleted one
+    Given I created a new payment with id abc
+    And I deleted that payment
+    When I create that payment
+    Then I should have status code 201
+    And I should have header ETag equal to "2"
+    And I should have a json
+    And that json should have int at data.version equal to 2
+    And that json should not have a data.deleted_at
+    And I should have 1 payment(s)
+
+  Scenario: Versions of a payment created over a deleted one
+    Given a payment with id abc
+    And that payment has reference ref1
+    And I created that payment
+    And I deleted that payment
+    And a payment with id abc
+    And that payment belongs to organisation org2
+    And I created that payment
+    When I get the versions of that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have int at data[0].version equal to 2
+    And that json should have string at data[0].operation equal to create
+    And that json should have string at data[0].payment.organisation_id equal to org2
+    And that json should not have a data[0].payment.attributes.reference
+    And I get version 0 of that payment
+    And I should have status code 404
+    And I get version 1 of that payment
+    And I should have status code 404
+
+  Scenario: Diff of a payment created over a deleted one
+    Given a payment with id abc
+    And that payment has reference ref1
+    And I created that payment
+    And I deleted that payment
+    And a payment with id abc
+    And that payment belongs to organisation org2
+    And I created that payment
+    When I get the diff of that payment with from=1
+    Then I should have status code 404
+
+  Scenario: Stale ETag of a deleted payment
+    Given I created a new payment with id abc
+    And I deleted that payment
+    And I created that payment
+    And I use header If-Match equal to "0"
+    When I update that payment
+    Then I should have status code 412
+
+  Scenario: Batch creating payments over deleted ones
+    Given I created a new payment with id abc
+    And I deleted that payment
+    And a batch of payments with ids abc,def
+    When I create that batch
+    Then I should have status code 201
+    And I should have a json
+    And that json should have int at meta.created equal to 2
+    And that json should have int at data[0].data.version equal to 2
+    And a payment with id abc
+    And I get the versions of that payment
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].operation equal to create
+
+  Scenario: Partial batch creating payments over deleted ones
+    Given I created a new payment with id abc
+    And I deleted that payment
+    And a batch of payments with ids abc,def
+    When I create that batch in partial mode
+    Then I should have status code 201
+    And I should have a json
+    And that json should have int at meta.created equal to 2
+    And that json should have int at data[0].data.version equal to 2
+    And a payment with id abc
+    And I get the versions of that payment
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].operation equal to create
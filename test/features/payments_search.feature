@@ -0,0 +1,74 @@
+Feature: Search payments
+  In order to find the payments I am looking for
+  As a product owner
+  I need to filter payment listings
+
+  Background:
+    Given a payment with id abc and amount 10.00 GBP
+    And that payment has reference Invoice 2019-001
+    And I created that payment
+    And a payment with id def and amount 250.50 EUR
+    And that payment belongs to organisation org2
+    And that payment has reference invoice 2019-002
+    And I created that payment
+    And a payment with id ghi and amount 1000 JPY
+    And I created that payment
+    And I performed request-approval on that payment
+
+  Scenario: Filtering by organisation
+    When I get payments with organisation_id=org2
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to def
+
+  Scenario: Filtering by status
+    When I get payments with status=pending_approval
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to ghi
+
+  Scenario: Filtering by currency
+    When I get payments with currency=EUR
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to def
+
+  Scenario: Filtering by amount range
+    When I get payments with amount_min=10&amount_max=300
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 2 items
+
+  Scenario: Filtering by reference
+    When I get payments with reference=INVOICE%202019
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 2 items
+
+  Scenario: Combining filters
+    When I get payments with reference=invoice&organisation_id=org1
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have string at data[0].id equal to abc
+
+  Scenario: Filters are kept in pagination links
+    When I get payments with reference=invoice&from=0&to=1
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at links.next equal to http://localhost:8080/v1/payments?from=1&to=2&reference=invoice
+
+  Scenario: Invalid filters
+    When I get payments with status=unknown&currency=XXX&amount_min=abc
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have 3 items at errors
+    And that json should have string at errors[0].parameter equal to status
+
+  Scenario: Inverted amount range
+    When I get payments with amount_min=100&amount_max=10
+    Then I should have status code 400
+    And I should have a problem
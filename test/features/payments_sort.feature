@@ -0,0 +1,85 @@
+Feature: Sort payments
+  In order to reconcile payments
+  As a product owner
+  I need to choose the order payments are listed in
+
+  Background:
+    Given a payment with id abc and amount 10.00 GBP
+    And that payment has reference b
+    And I created that payment
+    And a payment with id def and amount 2.50 GBP
+    And that payment has reference a
+    And I created that payment
+    And a payment with id ghi and amount 100 GBP
+    And I created that payment
+    And a payment with id jkl and amount 2.50 EUR
+    And I created that payment
+
+  Scenario: Sorting by amount
+    When I get payments with sort=amount
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data[0].id equal to def
+    And that json should have string at data[1].id equal to jkl
+    And that json should have string at data[2].id equal to abc
+    And that json should have string at data[3].id equal to ghi
+
+  Scenario: Sorting by descending amount
+    When I get payments with sort=-amount
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data[0].id equal to ghi
+    And that json should have string at data[1].id equal to abc
+    And that json should have string at data[2].id equal to def
+    And that json should have string at data[3].id equal to jkl
+
+  Scenario: Sorting by several fields
+    When I get payments with sort=currency,-amount
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data[0].id equal to jkl
+    And that json should have string at data[1].id equal to ghi
+    And that json should have string at data[2].id equal to abc
+    And that json should have string at data[3].id equal to def
+
+  Scenario: Sorting by a missing attribute
+    When I get payments with sort=-reference
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data[0].id equal to abc
+    And that json should have string at data[1].id equal to def
+    And that json should have string at data[2].id equal to ghi
+    And that json should have string at data[3].id equal to jkl
+
+  Scenario: Sorting with offsets
+    When I get payments with sort=-amount&from=0&to=2
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at links.next equal to http://localhost:8080/v1/payments?from=2&to=4&sort=-amount
+    And I follow the next link
+    And I should have a json
+    And that json should have string at data[0].id equal to def
+    And that json should have string at data[1].id equal to jkl
+
+  Scenario: Sorting with a cursor
+    When I get payments with sort=-amount&limit=2
+    Then I should have status code 200
+    And I should have a json
+    And I follow the next link
+    And I should have a json
+    And that json should have 2 items
+    And that json should have string at data[0].id equal to def
+    And that json should have string at data[1].id equal to jkl
+    And that json should not have a links.next
+    And I follow the prev link
+    And I should have a json
+    And that json should have string at data[0].id equal to ghi
+    And that json should have string at data[1].id equal to abc
+    And that json should not have a links.prev
+
+  Scenario: Invalid sort field
+    When I get payments with sort=amount,-attributes,amount
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have 2 items at errors
+    And that json should have string at errors[0].parameter equal to sort
@@ -0,0 +1,71 @@
+Feature: Payment lifecycle
+  In order to process payments
+  As a product owner
+  I need payments to move through a well defined lifecycle
+
+  Scenario: New payments are created
+    Given a payment with id abc
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have string at data.status equal to created
+
+  Scenario: Request approval
+    Given I created a new payment with id abc
+    When I perform request-approval on that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.status equal to pending_approval
+    And that json should have int at data.version equal to 1
+
+  Scenario: Submit after approval
+    Given I created a new payment with id abc
+    And I performed request-approval on that payment
+    When I perform submit on that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.status equal to submitted
+
+  Scenario: Submit without approval
+    Given I created a new payment with id abc
+    When I perform submit on that payment
+    Then I should have status code 409
+    And I should have a problem
+
+  Scenario: Full lifecycle
+    Given I created a new payment with id abc
+    And I performed request-approval on that payment
+    And I performed submit on that payment
+    And I performed accept on that payment
+    And I performed settle on that payment
+    When I perform return on that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.status equal to returned
+
+  Scenario: Cancelled payments are final
+    Given I created a new payment with id abc
+    And I performed cancel on that payment
+    When I perform request-approval on that payment
+    Then I should have status code 409
+
+  Scenario: Submitted payments can no longer be updated
+    Given I created a new payment with id abc
+    And I performed request-approval on that payment
+    And I performed submit on that payment
+    When I update version 2 of that payment
+    Then I should have status code 409
+    And I should have a problem
+
+  Scenario: Updates keep the payment status
+    Given I created a new payment with id abc
+    And I performed request-approval on that payment
+    When I update version 1 of that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.status equal to pending_approval
+
+  Scenario: Non existing payment
+    Given a payment with id abc
+    When I perform submit on that payment
+    Then I should have status code 404
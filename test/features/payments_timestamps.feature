@@ -0,0 +1,59 @@
+Feature: Payment timestamps
+  In order to audit payments
+  As a product owner
+  I need to know when payments were created and last updated
+
+  Scenario: Created payment
+    Given a payment with id abc
+    When I create that payment
+    Then I should have status code 201
+    And I should have a json
+    And that json should have a data.created_at
+    And that json should have a data.updated_at
+    And that json should not have a data.deleted_at
+
+  Scenario: Updated payment
+    Given I created a new payment with id abc
+    When I patch that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    Then I should have status code 200
+    And I should have a json
+    And that json should have a data.created_at
+    And that json should have a data.updated_at
+
+  Scenario: Timestamps are read-only
+    Given I created a new payment with id abc
+    And I patch that payment as application/merge-patch+json with {"data":{"created_at":"2001-01-01T00:00:00Z"}}
+    And I should have status code 422
+    When I get payments with created_before=2002-01-01
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 0 items
+
+  Scenario: Filtering by creation and update dates
+    Given I created a new payment with id abc
+    And I created a new payment with id def
+    When I get payments with created_after=2001-01-01&updated_after=2001-01-01T00:00:00Z&updated_before=2999-01-01
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 2 items
+    And that json should have string at links.self equal to http://localhost:8080/v1/payments?from=0&to=20&created_after=2001-01-01&updated_after=2001-01-01T00%3A00%3A00Z&updated_before=2999-01-01
+
+  Scenario: Sorting by creation date
+    Given I created a new payment with id def
+    And I created a new payment with id abc
+    When I get payments with sort=-created_at&limit=1
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And I follow the next link
+    And I should have a json
+    And that json should have 1 items
+    And that json should not have a links.next
+
+  Scenario: Invalid dates
+    When I get payments with created_after=yesterday&updated_before=2019-02-30
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have 2 items at errors
+    And that json should have string at errors[0].parameter equal to created_after
+    And that json should have string at errors[1].parameter equal to updated_before
@@ -17,10 +17,23 @@ Feature: Update payments
     Given I created a new payment with id abc
     And I deleted that payment
     When I update version 1 of that payment
-    Then I should have status code 404
+    Then I should have status code 410
 
   Scenario: Obsolete version
     Given I created a new payment with id abc
     And I updated that payment
     When I update version 0 of that payment
     Then I should have status code 409
+
+  Scenario: Moving a payment to another organisation
+    Given I created a new payment with id abc
+    And that payment belongs to organisation org2
+    When I update that payment
+    Then I should have status code 422
+    And I should have a problem
+    And that json should have string at errors[0].pointer equal to /data/organisation_id
+    And that json should have string at errors[0].code equal to read_only
+    And I get that payment
+    And I should have a json
+    And that json should have string at data.organisation_id equal to org1
+    And that json should have int at data.version equal to 0
@@ -0,0 +1,120 @@
+Feature: Payment history
+  In order to investigate disputed payments
+  As a product owner
+  I need to see every version of a payment, and who wrote it
+
+  Scenario: Non existing payment
+    Given a payment with id abc
+    When I get the versions of that payment
+    Then I should have status code 404
+
+  Scenario: Created payment
+    Given a payment with id abc
+    And I use header X-Actor equal to alice
+    And I created that payment
+    When I get the versions of that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 1 items
+    And that json should have int at data[0].version equal to 0
+    And that json should have string at data[0].operation equal to create
+    And that json should have string at data[0].actor equal to alice
+    And that json should have a data[0].request_id
+    And that json should have a data[0].recorded_at
+    And that json should have string at data[0].payment.attributes.amount equal to 1.00
+
+  Scenario: Request ids are assigned by the server
+    Given a payment with id abc
+    And I use header X-Request-Id equal to forged
+    And I created that payment
+    When I get the versions of that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have a data[0].request_id
+    And that json should have string at data[0].request_id other than forged
+
+  Scenario: Updated payment
+    Given I created a new payment with id abc
+    And I patched that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    And I performed request-approval on that payment
+    When I get the versions of that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 3 items
+    And that json should have string at data[1].operation equal to update
+    And that json should have string at data[1].payment.attributes.reference equal to ref1
+    And that json should have string at data[2].payment.status equal to pending_approval
+
+  Scenario: Deleted payment
+    Given I created a new payment with id abc
+    And I deleted that payment
+    When I get the versions of that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have 2 items
+    And that json should have string at data[1].operation equal to delete
+    And that json should have int at data[1].version equal to 1
+    And that json should have a data[1].payment.deleted_at
+
+  Scenario: The version of a delete
+    Given I created a new payment with id abc
+    And I patched that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    And I use header If-Match equal to "1"
+    And I delete that payment, without saying which version
+    And I should have status code 204
+    When I get version 2 of that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at data.operation equal to delete
+    And that json should have a data.payment.deleted_at
+    And I get version 1 of that payment
+    And I should have a json
+    And that json should have string at data.operation equal to update
+
+  Scenario: A version of a payment
+    Given I created a new payment with id abc
+    And I patched that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    And I patched that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref2"}}}
+    When I get version 1 of that payment
+    Then I should have status code 200
+    And I should have a json
+    And that json should have int at data.version equal to 1
+    And that json should have string at data.payment.attributes.reference equal to ref1
+    And that json should have string at links.versions equal to http://localhost:8080/v1/payments/abc/versions
+
+  Scenario: Non existing version
+    Given I created a new payment with id abc
+    When I get version 3 of that payment
+    Then I should have status code 404
+
+  Scenario: Diff with the previous version
+    Given I created a new payment with id abc
+    And I patched that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1","amount":"2"}}}
+    When I get the diff of that payment
+    Then I should have status code 200
+    And I should have content-type application/json-patch+json
+    And I should have a json
+    And that json should have string at 0.op equal to replace
+    And that json should have string at 0.path equal to /data/attributes/amount
+    And that json should have string at 0.value equal to 2.00
+    And that json should have string at 1.op equal to add
+    And that json should have string at 1.path equal to /data/attributes/reference
+    And that json should have string at 1.value equal to ref1
+
+  Scenario: Diff between two versions
+    Given I created a new payment with id abc
+    And I patched that payment as application/merge-patch+json with {"data":{"attributes":{"reference":"ref1"}}}
+    And I patched that payment as application/merge-patch+json with {"data":{"attributes":{"reference":null,"amount":"5"}}}
+    When I get the diff of that payment with from=0&to=2
+    Then I should have status code 200
+    And I should have a json
+    And that json should have string at 0.op equal to replace
+    And that json should have string at 0.path equal to /data/attributes/amount
+    And that json should have string at 0.value equal to 5.00
+
+  Scenario: Invalid diff
+    Given I created a new payment with id abc
+    When I get the diff of that payment with from=first
+    Then I should have status code 400
+    And I should have a problem
+    And that json should have string at errors[0].parameter equal to from
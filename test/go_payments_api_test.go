@@ -55,29 +55,66 @@ func FeatureContext(s *godog.Suite) {
 	s.Step(`^I query the metrics endpoint$`, w.IQueryTheMetricsEndpoint)
 	s.Step(`^I should have a json$`, w.IShouldHaveAJson)
 	s.Step(`^I should have a text$`, w.IShouldHaveAText)
+	s.Step(`^I should have a problem$`, w.IShouldHaveAProblem)
 	s.Step(`^I should have status code (\d+)$`, w.IShouldHaveStatusCode)
 	s.Step(`^I should have content-type (.*)$`, w.IShouldHaveContentType)
+	s.Step(`^I should have header (\S+) equal to (.*)$`, w.IShouldHaveHeader)
+	s.Step(`^I should have the location of the payment in that json$`, w.IShouldHaveTheLocationOfThatJson)
+	s.Step(`^I use idempotency key (\S+)$`, w.IUseIdempotencyKey)
+	s.Step(`^I use header (\S+) equal to (.*)$`, w.IUseHeader)
 	s.Step(`^that json should have string at (.*) equal to (.*)$`, w.ThatJsonShouldHaveString)
+	s.Step(`^that json should have string at (.*) other than (.*)$`, w.ThatJsonShouldHaveStringOtherThan)
 	s.Step(`^that json should have int at (.*) equal to (.*)$`, w.ThatJsonShouldHaveInt)
+	s.Step(`^that json should have bool at (.*) equal to (true|false)$`, w.ThatJsonShouldHaveBool)
 	s.Step(`^that json should have (\d+) items$`, w.ThatJsonShouldHaveItems)
+	s.Step(`^that json should have (\d+) items at (.*)$`, w.ThatJsonShouldHaveItemsAt)
+	s.Step(`^that json should not have an? (.*)$`, w.ThatJsonShouldNotHaveA)
 	s.Step(`^that json should have an (.*)$`, w.ThatJsonShouldHaveA)
 	s.Step(`^that json should have a (.*)$`, w.ThatJsonShouldHaveA)
 	s.Step(`^that text should match (.*)$`, w.ThatTextShouldMatch)
 	s.Step(`^I get all payments$`, w.IGetAllPayments)
 	s.Step(`^I get payments (\d+) to (\d+)$`, w.IGetPaymentsFromTo)
 	s.Step(`^I get payments without from/to$`, w.IGetPaymentsWithoutFromTo)
+	s.Step(`^I get payments with (\S+)$`, w.IGetPaymentsWith)
 	s.Step(`^a payment with id ([a-z]+)$`, w.APaymentWithId)
+	s.Step(`^a payment without id$`, w.APaymentWithoutId)
+	s.Step(`^I follow the location header$`, w.IFollowTheLocationHeader)
+	s.Step(`^I follow the (\S+) link$`, w.IFollowTheLink)
+	s.Step(`^a complete payment with id ([a-z]+)$`, w.ACompletePaymentWithId)
+	s.Step(`^a payment with id ([a-z]+) and invalid details$`, w.APaymentWithIdAndInvalidDetails)
 	s.Step(`^a payment without organisation, and id ([a-z]+)$`, w.APaymentWithIdNoOrganisation)
-	s.Step(`^a payment with id ([a-z]+) and amount (.*)$`, w.APaymentWithIdAmount)
+	s.Step(`^a payment without organisation, and id ([a-z]+) and amount (.*)$`, w.APaymentWithIdAmountNoOrganisation)
+	s.Step(`^a payment with id ([a-z]+) and amount (\S+) ([A-Z]{3})$`, w.APaymentWithIdAmountCurrency)
+	s.Step(`^a payment with id ([a-z]+) and amount (\S+)$`, w.APaymentWithIdAmount)
 	s.Step(`^I create that payment$`, w.ICreateThatPayment)
+	s.Step(`^I created that payment$`, w.ICreatedThatPayment)
+	s.Step(`^a batch of payments with ids ([a-z,]+)$`, w.ABatchOfPaymentsWithIds)
+	s.Step(`^a batch of (\d+) payments without id$`, w.ABatchOfPaymentsWithoutIds)
+	s.Step(`^that batch has a payment without organisation, and id ([a-z]+)$`, w.ThatBatchHasAPaymentWithoutOrganisationAndId)
+	s.Step(`^I create that batch$`, w.ICreateThatBatch)
+	s.Step(`^I create that batch in (\S+) mode$`, w.ICreateThatBatchInMode)
+	s.Step(`^that payment belongs to organisation (\S+)$`, w.ThatPaymentBelongsToOrganisation)
+	s.Step(`^that payment has reference (.*)$`, w.ThatPaymentHasReference)
 	s.Step(`^I update that payment$`, w.IUpdateThatPayment)
+	s.Step(`^I patch that payment as (\S+) with (.*)$`, w.IPatchThatPayment)
+	s.Step(`^I patched that payment as (\S+) with (.*)$`, w.IPatchedThatPayment)
 	s.Step(`^I delete that payment$`, w.IDeleteThatPayment)
 	s.Step(`^I get that payment$`, w.IGetThatPayment)
+	s.Step(`^I get the deleted payments$`, w.IGetTheDeletedPayments)
+	s.Step(`^I get the deleted payments with (\S+)$`, w.IGetTheDeletedPaymentsWith)
+	s.Step(`^I undelete that payment$`, w.IUndeleteThatPayment)
+	s.Step(`^I purge payments deleted more than (\S+) ago$`, w.IPurgePaymentsDeletedMoreThanAgo)
+	s.Step(`^I get the versions of that payment$`, w.IGetTheVersionsOfThatPayment)
+	s.Step(`^I get version (\d+) of that payment$`, w.IGetVersionOfThatPayment)
+	s.Step(`^I get the diff of that payment$`, w.IGetTheDiffOfThatPayment)
+	s.Step(`^I get the diff of that payment with (\S+)$`, w.IGetTheDiffOfThatPaymentWith)
 	s.Step(`^I created a new payment with id (.*)$`, w.ICreatedANewPaymentWithId)
 	s.Step(`^I created (\d+) payments$`, w.ICreatedPayments)
 	s.Step(`^I should have (\d+) payment\(s\)$`, w.IShouldHavePayments)
 	s.Step(`^I deleted that payment$`, w.IDeletedThatPayment)
 	s.Step(`^I updated that payment$`, w.IUpdatedThatPayment)
+	s.Step(`^I perform (.*) on that payment$`, w.IPerformOnThatPayment)
+	s.Step(`^I performed (.*) on that payment$`, w.IPerformedOnThatPayment)
 	s.Step(`^I delete version (\d+) of that payment$`, w.IDeleteVersionOfThatPayment)
 	s.Step(`^I delete that payment, without saying which version$`, w.IDeleteThatPaymentWithoutSayingWhichVersion)
 	s.Step(`^I update version (\d+) of that payment$`, w.IUpdateVersionOfThatPayment)